@@ -21,4 +21,14 @@ integration {
     name = "Unikraft Kraftkit Packaging"
     slug = "unikraft"
   }
+  component {
+    type = "data-source"
+    name = "Unikraft Package Catalog"
+    slug = "catalog"
+  }
+  component {
+    type = "data-source"
+    name = "Unikraft Kraftfile"
+    slug = "kraftfile"
+  }
 }
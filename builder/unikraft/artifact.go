@@ -1,6 +1,44 @@
 package unikraft
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+func init() {
+	// The state is sent to post-processors over RPC.
+	gob.Register([]ArtifactEntry{})
+	gob.Register(map[string][]string{})
+}
+
+// ArtifactEntry describes a single kernel produced by the builder.
+type ArtifactEntry struct {
+	// Path to the kernel image.
+	Kernel string `mapstructure:"kernel"`
+	// Path to the debuggable kernel image, if it was kept.
+	KernelDbg string `mapstructure:"kernel_dbg"`
+	// Path to the initramfs built for the kernel, if any.
+	Initramfs string `mapstructure:"initramfs"`
+	// Format of the initramfs, e.g. `cpio` or `erofs`.
+	RootfsFormat string `mapstructure:"rootfs_format"`
+	// Architecture the kernel was built for.
+	Architecture string `mapstructure:"architecture"`
+	// Platform the kernel was built for.
+	Platform string `mapstructure:"platform"`
+	// Name of the target in the Kraftfile.
+	Target string `mapstructure:"target"`
+	// Unikraft version the kernel was built with, i.e. `UK_FULLVERSION`.
+	Version string `mapstructure:"version"`
+	// Hex encoded SHA-256 digest of the kernel image.
+	Sha256 string `mapstructure:"sha256"`
+	// Components the kernel was built from.
+	Components []Component `mapstructure:"components"`
+}
 
 // packersdk.Artifact implementation
 type Artifact struct {
@@ -13,24 +51,94 @@ func (*Artifact) BuilderId() string {
 	return BuilderId
 }
 
+// Entries returns the kernels described by the artifact.
+func (a *Artifact) Entries() []ArtifactEntry {
+	entries, _ := a.StateData["entries"].([]ArtifactEntry)
+	return entries
+}
+
 func (a *Artifact) Files() []string {
-	files := append([]string{}, a.StateData["binaries"].([]string)...)
-	files = append(files, a.StateData["initramfs"].([]string)...)
+	var files []string
+
+	if binaries, ok := a.StateData["binaries"].([]string); ok {
+		files = append(files, binaries...)
+	}
+
+	for _, entry := range a.Entries() {
+		if entry.Initramfs != "" && !slices.Contains(files, entry.Initramfs) {
+			files = append(files, entry.Initramfs)
+		}
+	}
+
+	if sbom, ok := a.StateData["sbom"].(string); ok && sbom != "" {
+		files = append(files, sbom)
+	}
+
+	if vendorDir, ok := a.StateData["vendor_dir"].(string); ok && vendorDir != "" {
+		files = append(files, vendorDir)
+	}
+
+	// Packages saved to disk by the post-processor.
+	if output, ok := a.StateData["output"].(string); ok && output != "" {
+		files = append(files, output)
+	}
+
 	return files
 }
 
-func (*Artifact) Id() string {
-	return ""
+// Id returns the digest of the kernel if the artifact holds a single one,
+// or a digest over all kernel digests otherwise.
+func (a *Artifact) Id() string {
+	var digests []string
+	for _, entry := range a.Entries() {
+		if entry.Sha256 != "" {
+			digests = append(digests, entry.Sha256)
+		}
+	}
+
+	switch len(digests) {
+	case 0:
+		return ""
+	case 1:
+		return "sha256:" + digests[0]
+	}
+
+	sort.Strings(digests)
+	sum := sha256.Sum256([]byte(strings.Join(digests, "\n")))
+
+	return "sha256:" + hex.EncodeToString(sum[:])
 }
 
 func (a *Artifact) String() string {
-	s := ""
+	entries := a.Entries()
+	if len(entries) == 0 {
+		s := ""
+		for k, v := range a.StateData {
+			s += fmt.Sprintf("%s=%v ", k, v)
+		}
+
+		return s
+	}
+
+	lines := []string{"Kernels were built:"}
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s/%s: %s", entry.Platform, entry.Architecture, entry.Kernel)
+		if entry.Target != "" {
+			line = fmt.Sprintf("%s (%s)", line, entry.Target)
+		}
+		if entry.Version != "" {
+			line = fmt.Sprintf("%s, Unikraft %s", line, entry.Version)
+		}
+		if entry.Initramfs != "" && entry.RootfsFormat != "" && entry.RootfsFormat != RootfsFormatCpio {
+			line = fmt.Sprintf("%s, %s rootfs %s", line, entry.RootfsFormat, entry.Initramfs)
+		} else if entry.Initramfs != "" {
+			line = fmt.Sprintf("%s, initramfs %s", line, entry.Initramfs)
+		}
 
-	for k, v := range a.StateData {
-		s += fmt.Sprintf("%s=%v ", k, v)
+		lines = append(lines, line)
 	}
 
-	return s
+	return strings.Join(lines, "\n")
 }
 
 func (a *Artifact) State(name string) interface{} {
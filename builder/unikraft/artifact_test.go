@@ -0,0 +1,104 @@
+package unikraft
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestArtifact_ImplementsArtifact(t *testing.T) {
+	var _ packersdk.Artifact = &Artifact{}
+}
+
+func TestArtifact(t *testing.T) {
+	tests := []struct {
+		name  string
+		state map[string]interface{}
+		id    string
+		files []string
+	}{
+		{
+			name:  "empty",
+			state: map[string]interface{}{},
+		},
+		{
+			name: "missing entries",
+			state: map[string]interface{}{
+				"binaries": []string{"/app/.unikraft/build/app_qemu-x86_64"},
+				"entries":  nil,
+			},
+			files: []string{"/app/.unikraft/build/app_qemu-x86_64"},
+		},
+		{
+			name: "single kernel",
+			state: map[string]interface{}{
+				"binaries": []string{"/app/.unikraft/build/app_qemu-x86_64"},
+				"entries": []ArtifactEntry{{
+					Kernel:    "/app/.unikraft/build/app_qemu-x86_64",
+					Initramfs: "/app/.unikraft/build/initramfs-x86_64.cpio",
+					Sha256:    "b",
+				}},
+				"sbom": "/app/sbom.cdx.json",
+			},
+			id: "sha256:b",
+			files: []string{
+				"/app/.unikraft/build/app_qemu-x86_64",
+				"/app/.unikraft/build/initramfs-x86_64.cpio",
+				"/app/sbom.cdx.json",
+			},
+		},
+		{
+			name: "vendored components",
+			state: map[string]interface{}{
+				"vendor_dir": "/mirror",
+			},
+			files: []string{"/mirror"},
+		},
+		{
+			name: "multiple kernels",
+			state: map[string]interface{}{
+				"entries": []ArtifactEntry{
+					{Kernel: "b", Initramfs: "initramfs-x86_64.cpio", Sha256: "b"},
+					{Kernel: "a", Initramfs: "initramfs-x86_64.cpio", Sha256: "a"},
+				},
+			},
+			// sha256 of "a\nb"
+			id:    "sha256:7e18f737311b2dc3b2f269dd78396b0351f14fb66efa879f768cb23181883c78",
+			files: []string{"initramfs-x86_64.cpio"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Artifact{StateData: tt.state}
+
+			if got := a.Files(); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("expected files %v, got %v", tt.files, got)
+			}
+			if got := a.Id(); got != tt.id {
+				t.Errorf("expected id %q, got %q", tt.id, got)
+			}
+			if a.String() == "" && len(tt.state) > 0 {
+				t.Error("expected a description")
+			}
+		})
+	}
+}
+
+func TestArtifact_StringRootfsFormat(t *testing.T) {
+	a := &Artifact{StateData: map[string]interface{}{
+		"entries": []ArtifactEntry{{
+			Kernel:       "/app/.unikraft/build/app_fc-x86_64",
+			Initramfs:    "/app/.unikraft/build/rootfs-x86_64.erofs",
+			RootfsFormat: RootfsFormatErofs,
+			Architecture: "x86_64",
+			Platform:     "fc",
+		}},
+	}}
+
+	if got := a.String(); !strings.Contains(got, "erofs rootfs /app/.unikraft/build/rootfs-x86_64.erofs") {
+		t.Errorf("expected the rootfs format in %q", got)
+	}
+}
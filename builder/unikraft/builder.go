@@ -2,12 +2,12 @@ package unikraft
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
-	"github.com/hashicorp/packer-plugin-sdk/template/config"
 )
 
 const BuilderId = "packer.builder.unikraft"
@@ -20,10 +20,7 @@ type Builder struct {
 func (b *Builder) ConfigSpec() hcldec.ObjectSpec { return b.config.FlatMapstructure().HCL2Spec() }
 
 func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings []string, err error) {
-	err = config.Decode(&b.config, &config.DecodeOpts{
-		PluginType:  "packer.builder.unikraft",
-		Interpolate: true,
-	}, raws...)
+	warnings, err = b.config.Prepare(raws...)
 	if err != nil {
 		return nil, warnings, err
 	}
@@ -36,19 +33,48 @@ func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings
 }
 
 func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
+	kraftCtx, cleanup, err := KraftCommandContext(ctx, ui, KraftOptions{
+		LogLevel:       b.config.LogLevel,
+		RegistryAuth:   b.config.RegistryAuth,
+		Offline:        b.config.Offline,
+		ManifestMirror: b.config.ManifestMirror,
+		// Offline, the manifests are not updated and thus never written.
+		IsolateManifests: !b.config.Offline &&
+			(len(b.config.Sources) > 0 || b.config.SourcesNoDefault || b.config.ManifestMirror != ""),
+	})
+	if err != nil {
+		err := fmt.Errorf("error encountered initialising kraft: %s", err)
+		ui.Error(err.Error())
+		return nil, err
+	}
+	defer cleanup()
+
 	driver := &KraftDriver{
 		Ctx:            &b.config.ctx,
 		Ui:             ui,
-		CommandContext: KraftCommandContext(ui, b.config.LogLevel),
+		CommandContext: kraftCtx,
+		Offline:        b.config.Offline,
 	}
 
 	steps := []multistep.Step{
 		&StepPkgSource{},
 		&StepPkgUpdate{},
+		&StepLockfilePin{},
 		&StepPkgPull{},
-		&StepSet{},
-		&StepBuild{},
-		new(commonsteps.StepProvision),
+	}
+
+	if b.config.VendorOnly {
+		steps = append(steps, &StepVendor{})
+	} else {
+		steps = append(steps,
+			&StepLockfileCheck{},
+			&StepSet{},
+			&StepRootfsImage{},
+			&StepRootfsCommunicator{},
+			new(commonsteps.StepProvision),
+			&StepBuild{},
+			&StepSbom{},
+		)
 	}
 
 	// Setup the state bag and initial state for the steps
@@ -73,7 +99,17 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 
 	artifact := &Artifact{
 		StateData: map[string]interface{}{
-			"binaries": state.Get("binaries"),
+			"binaries":   state.Get("binaries"),
+			"kernels":    state.Get("kernels"),
+			"entries":    state.Get("entries"),
+			"sbom":       state.Get("sbom"),
+			"vendor_dir": state.Get("vendor_dir"),
+			"image_args": state.Get("image_args"),
+			"image_env":  state.Get("image_env"),
+			"build_path": b.config.Path,
+			// The post-processor resolves packages as the builder did.
+			"offline":         b.config.Offline,
+			"manifest_mirror": b.config.ManifestMirror,
 		},
 	}
 	return artifact, nil
@@ -0,0 +1,441 @@
+package unikraft
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestBuilder_ImplementsBuilder(t *testing.T) {
+	var _ packersdk.Builder = &Builder{}
+}
+
+func TestBuilder_Prepare(t *testing.T) {
+	dotconfig := filepath.Join(t.TempDir(), ".config")
+	if err := os.WriteFile(dotconfig, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := t.TempDir()
+	if err := os.WriteFile(filepath.Join(project, "Kraftfile"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mirrorIndex := filepath.Join(t.TempDir(), "index.yaml")
+	if err := os.WriteFile(mirrorIndex, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rootfsImage := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(rootfsImage, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		raw      map[string]interface{}
+		err      string
+		warnings int
+		check    func(t *testing.T, c *Config)
+	}{
+		{
+			name: "minimal",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+			},
+		},
+		{
+			name: "missing build_path",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+			},
+			err: "build_path must be specified",
+		},
+		{
+			name: "missing architecture",
+			raw: map[string]interface{}{
+				"platform":   "qemu",
+				"build_path": "/tmp/app",
+			},
+			err: "architecture must be specified",
+		},
+		{
+			name: "all targets without architecture and platform",
+			raw: map[string]interface{}{
+				"all_targets": true,
+				"build_path":  "/tmp/app",
+			},
+		},
+		{
+			name: "negative jobs",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"jobs":         -1,
+			},
+			err: "jobs must not be negative",
+		},
+		{
+			name: "kconfig prefix",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"kconfig":      map[string]string{"LIBVFSCORE": "y", "CONFIG_LIBUKDEBUG": "n"},
+			},
+			check: func(t *testing.T, c *Config) {
+				want := map[string]string{"CONFIG_LIBVFSCORE": "y", "CONFIG_LIBUKDEBUG": "n"}
+				if !reflect.DeepEqual(c.KConfig, want) {
+					t.Errorf("expected kconfig %v, got %v", want, c.KConfig)
+				}
+			},
+		},
+		{
+			name: "deprecated options",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"options":      "CONFIG_LIBVFSCORE=y CONFIG_LIBUKDEBUG=n",
+				"kconfig":      map[string]string{"CONFIG_LIBUKDEBUG": "y"},
+			},
+			warnings: 1,
+			check: func(t *testing.T, c *Config) {
+				want := map[string]string{"CONFIG_LIBVFSCORE": "y", "CONFIG_LIBUKDEBUG": "y"}
+				if !reflect.DeepEqual(c.KConfig, want) {
+					t.Errorf("expected kconfig %v, got %v", want, c.KConfig)
+				}
+			},
+		},
+		{
+			name: "invalid option",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"options":      "CONFIG_LIBVFSCORE",
+			},
+			err:      "invalid option",
+			warnings: 1,
+		},
+		{
+			name: "dotconfig",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"dotconfig":    dotconfig,
+			},
+		},
+		{
+			name: "missing dotconfig",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"dotconfig":    dotconfig + ".missing",
+			},
+			err: "does not exist",
+		},
+		{
+			name: "dotconfig directory",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"dotconfig":    project,
+			},
+			err: "is a directory",
+		},
+		{
+			name: "kraftfile",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   project,
+				"kraftfile":    "Kraftfile",
+			},
+		},
+		{
+			name: "missing kraftfile",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   project,
+				"kraftfile":    "kraft.yaml",
+			},
+			err: "does not exist",
+		},
+		{
+			name: "kraftfile directory",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   project,
+				"kraftfile":    ".",
+			},
+			err: "is a directory",
+		},
+		{
+			name: "kraftfile of pulled project",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   project,
+				"kraftfile":    "kraft.yaml",
+				"pull_source":  "app-nginx",
+				"workdir":      project,
+			},
+		},
+		{
+			name: "invalid env",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"env":          map[string]string{"A=B": "C"},
+			},
+			err: "invalid environment variable name",
+		},
+		{
+			name: "registry auth",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"registry_auth": []map[string]interface{}{
+					{"endpoint": "localhost:5000", "user": "packer", "token": "s3cr3t-t0k3n"},
+					{"endpoint": "index.unikraft.io", "verify_ssl": false},
+				},
+			},
+			check: func(t *testing.T, c *Config) {
+				if len(c.RegistryAuth) != 2 {
+					t.Fatalf("expected 2 registry credentials, got %d", len(c.RegistryAuth))
+				}
+				if !*c.RegistryAuth[0].VerifySSL || *c.RegistryAuth[1].VerifySSL {
+					t.Error("expected verify_ssl to default to true")
+				}
+				if got := packersdk.LogSecretFilter.FilterString("token s3cr3t-t0k3n"); got != "token <sensitive>" {
+					t.Errorf("expected the token to be filtered from logs, got %q", got)
+				}
+			},
+		},
+		{
+			name: "registry auth without endpoint",
+			raw: map[string]interface{}{
+				"architecture":  "x86_64",
+				"platform":      "qemu",
+				"build_path":    "/tmp/app",
+				"registry_auth": []map[string]interface{}{{"token": "t0k3n"}},
+			},
+			err: "registry_auth endpoint must be specified",
+		},
+		{
+			name: "offline with remote source",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"offline":      true,
+				"sources":      []string{"https://manifests.kraftkit.sh/index.yaml"},
+			},
+			err: "cannot be used offline",
+		},
+		{
+			name: "manifest mirror without index",
+			raw: map[string]interface{}{
+				"architecture":    "x86_64",
+				"platform":        "qemu",
+				"build_path":      "/tmp/app",
+				"manifest_mirror": t.TempDir(),
+			},
+			err: "holds no index.yaml",
+		},
+		{
+			name: "manifest mirror",
+			raw: map[string]interface{}{
+				"architecture":    "x86_64",
+				"platform":        "qemu",
+				"build_path":      "/tmp/app",
+				"offline":         true,
+				"manifest_mirror": filepath.Dir(mirrorIndex),
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.ManifestMirror != filepath.Dir(mirrorIndex) {
+					t.Errorf("unexpected manifest mirror %s", c.ManifestMirror)
+				}
+			},
+		},
+		{
+			name: "default rootfs",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Rootfs != "/tmp/app/rootfs" {
+					t.Errorf("expected rootfs /tmp/app/rootfs, got %s", c.Rootfs)
+				}
+				if c.RootfsFormat != RootfsFormatCpio {
+					t.Errorf("expected rootfs format %s, got %s", RootfsFormatCpio, c.RootfsFormat)
+				}
+			},
+		},
+		{
+			name: "absolute rootfs",
+			raw: map[string]interface{}{
+				"architecture":  "x86_64",
+				"platform":      "qemu",
+				"build_path":    "/tmp/app",
+				"rootfs":        "/srv/rootfs",
+				"rootfs_chroot": true,
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Rootfs != "/srv/rootfs" || !c.RootfsChroot || !c.rootfsSet {
+					t.Errorf("unexpected rootfs %s (chroot %v)", c.Rootfs, c.RootfsChroot)
+				}
+			},
+		},
+		{
+			name: "rootfs format",
+			raw: map[string]interface{}{
+				"architecture":       "x86_64",
+				"platform":           "qemu",
+				"build_path":         "/tmp/app",
+				"rootfs_format":      "erofs",
+				"rootfs_compression": "lz4",
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.RootfsFormat != "erofs" || c.RootfsCompression != "lz4" {
+					t.Errorf("unexpected rootfs format %s (compression %s)", c.RootfsFormat, c.RootfsCompression)
+				}
+			},
+		},
+		{
+			name: "invalid rootfs compression",
+			raw: map[string]interface{}{
+				"architecture":       "x86_64",
+				"platform":           "qemu",
+				"build_path":         "/tmp/app",
+				"rootfs_format":      "ext4",
+				"rootfs_compression": "gzip",
+			},
+			err: "does not support compression",
+		},
+		{
+			name: "missing rootfs image",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"rootfs_image": "/nonexistent/app.tar",
+			},
+			err: "rootfs_image /nonexistent/app.tar does not exist",
+		},
+		{
+			name: "rootfs with rootfs image",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"rootfs":       ".",
+				"rootfs_image": rootfsImage,
+			},
+			err: "rootfs cannot be set with rootfs_image",
+		},
+		{
+			name: "rootfs image",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"rootfs_image": rootfsImage,
+			},
+			check: func(t *testing.T, c *Config) {
+				if c.Rootfs != "/tmp/app/.unikraft/rootfs" {
+					t.Errorf("expected rootfs /tmp/app/.unikraft/rootfs, got %s", c.Rootfs)
+				}
+			},
+		},
+		{
+			name: "vendor only without vendor dir",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"vendor_only":  true,
+			},
+			err: "vendor_dir must be specified",
+		},
+		{
+			name: "parallel targets without all targets",
+			raw: map[string]interface{}{
+				"architecture":     "x86_64",
+				"platform":         "qemu",
+				"build_path":       "/tmp/app",
+				"parallel_targets": 2,
+			},
+			warnings: 1,
+		},
+		{
+			name: "keep going without parallel targets",
+			raw: map[string]interface{}{
+				"architecture": "x86_64",
+				"platform":     "qemu",
+				"build_path":   "/tmp/app",
+				"all_targets":  true,
+				"keep_going":   true,
+			},
+			warnings: 1,
+		},
+		{
+			name: "keep going with parallel targets",
+			raw: map[string]interface{}{
+				"architecture":     "x86_64",
+				"platform":         "qemu",
+				"build_path":       "/tmp/app",
+				"all_targets":      true,
+				"parallel_targets": 2,
+				"keep_going":       true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b Builder
+			generated, warnings, err := b.Prepare(tt.raw)
+
+			if len(warnings) != tt.warnings {
+				t.Errorf("expected %d warnings, got %v", tt.warnings, warnings)
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(generated, []string{"binaries"}) {
+				t.Errorf("unexpected generated variables %v", generated)
+			}
+
+			if tt.check != nil {
+				tt.check(t, &b.config)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var _ packersdk.Communicator = (*RootfsCommunicator)(nil)
+
+// RootfsCommunicator is a communicator which operates on the root filesystem
+// directory of the project on the host, such that provisioners can add files
+// to the initramfs before it is built.  Remote paths are relative to the
+// rootfs, e.g. `/etc/nginx.conf` is the file `etc/nginx.conf` of the rootfs,
+// and their symlinks are resolved within the rootfs.
+type RootfsCommunicator struct {
+	// Path to the rootfs directory, which is created when needed.
+	Path string
+	// Run commands chrooted into the rootfs.  Otherwise commands run on the
+	// host with the rootfs as working directory.
+	Chroot bool
+
+	// provisioned tells whether commands ran in the rootfs or files were
+	// uploaded to it.
+	provisioned bool
+}
+
+// path returns the host path of the given path within the rootfs.  Symlinks
+// are resolved as if the rootfs was the root directory, such that neither
+// `..` nor absolute symlinks point out of the rootfs.  The last element of the
+// path is only resolved if followLast is set.
+func (c *RootfsCommunicator) path(p string, followLast bool) (string, error) {
+	return resolveRootfsPath(c.Path, p, followLast)
+}
+
+func (c *RootfsCommunicator) Start(ctx context.Context, cmd *packersdk.RemoteCmd) error {
+	c.provisioned = true
+
+	if err := os.MkdirAll(c.Path, 0755); err != nil {
+		return err
+	}
+
+	var localCmd *exec.Cmd
+	if c.Chroot {
+		localCmd = exec.CommandContext(ctx, "chroot", c.Path, "/bin/sh", "-c", cmd.Command)
+	} else {
+		localCmd = exec.CommandContext(ctx, "/bin/sh", "-c", cmd.Command)
+		localCmd.Dir = c.Path
+	}
+
+	localCmd.Env = append(os.Environ(), "ROOTFS="+c.Path)
+	localCmd.Stdin = cmd.Stdin
+	localCmd.Stdout = cmd.Stdout
+	localCmd.Stderr = cmd.Stderr
+
+	log.Printf("[INFO] (rootfs communicator): Executing %s in %s", cmd.Command, c.Path)
+	if err := localCmd.Start(); err != nil {
+		return err
+	}
+
+	go func() {
+		exitStatus := 0
+		if err := localCmd.Wait(); err != nil {
+			exitStatus = 1
+
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+					exitStatus = status.ExitStatus()
+				}
+			}
+		}
+
+		cmd.SetExited(exitStatus)
+	}()
+
+	return nil
+}
+
+func (c *RootfsCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	c.provisioned = true
+
+	dst, err := c.path(dst, true)
+	if err != nil {
+		return err
+	}
+
+	mode := fs.FileMode(0644)
+	if fi != nil {
+		mode = (*fi).Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, mode)
+}
+
+// UploadDir copies the directory src of the host into the rootfs.  As with
+// rsync, the directory itself is only created in dst if src has no trailing
+// slash.
+func (c *RootfsCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	c.provisioned = true
+
+	if !strings.HasSuffix(src, "/") {
+		dst = path.Join(dst, filepath.Base(src))
+	}
+
+	return copyTree(src, exclude, func(rel string, followLast bool) (string, error) {
+		return c.path(path.Join(dst, filepath.ToSlash(rel)), followLast)
+	})
+}
+
+func (c *RootfsCommunicator) Download(src string, w io.Writer) error {
+	src, err := c.path(src, true)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// DownloadDir copies the directory src of the rootfs to the host, following
+// the same rules as UploadDir.
+func (c *RootfsCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	if !strings.HasSuffix(src, "/") {
+		dst = filepath.Join(dst, filepath.Base(filepath.Clean("/"+src)))
+	}
+
+	src, err := c.path(src, true)
+	if err != nil {
+		return err
+	}
+
+	return copyTree(src, exclude, func(rel string, _ bool) (string, error) {
+		return filepath.Join(dst, rel), nil
+	})
+}
+
+// copyTree copies the files, directories and symlinks below src to the paths
+// returned by target for their paths relative to src, keeping their
+// permissions.  Symlinks are copied as they are rather than followed, so
+// target only resolves the last element of their path for the other files.
+// Paths relative to src which match one of the exclude patterns, or whose
+// base name does, are skipped.
+func copyTree(src string, exclude []string, target func(rel string, followLast bool) (string, error)) error {
+	return filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		if rel != "." && excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		isLink := info.Mode()&fs.ModeSymlink != 0
+
+		dst, err := target(rel, !isLink)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+			return os.Chmod(dst, info.Mode().Perm())
+
+		case isLink:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return os.Symlink(link, dst)
+
+		case info.Mode().IsRegular():
+			if err := copyFile(file, dst); err != nil {
+				return err
+			}
+			return os.Chmod(dst, info.Mode().Perm())
+
+		default:
+			return fmt.Errorf("cannot copy %s: unsupported file type %s", file, info.Mode().Type())
+		}
+	})
+}
+
+// excluded tells whether the relative path matches one of the patterns.
+func excluded(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// copyFile copies the file at src to dst, overwriting dst if it exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
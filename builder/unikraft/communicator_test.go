@@ -0,0 +1,282 @@
+package unikraft
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestRootfsCommunicator_Upload(t *testing.T) {
+	rootfs := t.TempDir()
+	comm := &RootfsCommunicator{Path: rootfs}
+
+	tests := map[string]string{
+		"/etc/app.conf":       "etc/app.conf",
+		"usr/bin/app":         "usr/bin/app",
+		"/../../etc/passwd":   "etc/passwd",
+		"/srv/../srv/www/foo": "srv/www/foo",
+	}
+
+	for dst, want := range tests {
+		if err := comm.Upload(dst, strings.NewReader(dst), nil); err != nil {
+			t.Fatalf("could not upload %s: %s", dst, err)
+		}
+
+		b, err := os.ReadFile(filepath.Join(rootfs, want))
+		if err != nil {
+			t.Fatalf("expected %s to be uploaded to %s: %s", dst, want, err)
+		}
+		if string(b) != dst {
+			t.Errorf("expected %s to hold %q, got %q", want, dst, b)
+		}
+
+		var buf bytes.Buffer
+		if err := comm.Download(dst, &buf); err != nil {
+			t.Fatalf("could not download %s: %s", dst, err)
+		}
+		if buf.String() != dst {
+			t.Errorf("expected to download %q, got %q", dst, buf.String())
+		}
+	}
+}
+
+func TestRootfsCommunicator_UploadDir(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "www")
+	files := map[string]os.FileMode{
+		"index.html":     0644,
+		"cgi/run.sh":     0755,
+		"cgi/run.sh.bak": 0644,
+		".git/HEAD":      0644,
+	}
+	for name, mode := range files {
+		file := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		exclude []string
+		files   []string
+	}{
+		{
+			name:  "directory",
+			src:   src,
+			files: []string{"srv/www/.git/HEAD", "srv/www/cgi/run.sh", "srv/www/cgi/run.sh.bak", "srv/www/index.html"},
+		},
+		{
+			name:  "contents",
+			src:   src + "/",
+			files: []string{"srv/.git/HEAD", "srv/cgi/run.sh", "srv/cgi/run.sh.bak", "srv/index.html"},
+		},
+		{
+			name:    "exclude",
+			src:     src,
+			exclude: []string{".git", "*.bak"},
+			files:   []string{"srv/www/cgi/run.sh", "srv/www/index.html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootfs := t.TempDir()
+			comm := &RootfsCommunicator{Path: rootfs}
+
+			if err := comm.UploadDir("/srv", tt.src, tt.exclude); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := listFiles(t, rootfs); !reflect.DeepEqual(got, tt.files) {
+				t.Errorf("expected files %v, got %v", tt.files, got)
+			}
+
+			for _, file := range tt.files {
+				if filepath.Base(file) != "run.sh" {
+					continue
+				}
+				info, err := os.Stat(filepath.Join(rootfs, file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != 0755 {
+					t.Errorf("expected %s to keep its mode, got %s", file, info.Mode())
+				}
+			}
+
+			out := t.TempDir()
+			if err := comm.DownloadDir("/srv/", out, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			var downloaded []string
+			for _, file := range tt.files {
+				downloaded = append(downloaded, strings.TrimPrefix(file, "srv/"))
+			}
+			if got := listFiles(t, out); !reflect.DeepEqual(got, downloaded) {
+				t.Errorf("expected downloaded files %v, got %v", downloaded, got)
+			}
+		})
+	}
+}
+
+func TestRootfsCommunicator_Symlinks(t *testing.T) {
+	host := t.TempDir()
+	rootfs := t.TempDir()
+	comm := &RootfsCommunicator{Path: rootfs}
+
+	// Absolute symlinks point to the host when followed outside the rootfs.
+	if err := os.Symlink(host, filepath.Join(rootfs, "abs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(host, "secret"), filepath.Join(rootfs, "file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../../..", filepath.Join(rootfs, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(host, "secret"), []byte("host"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(t.TempDir(), "www")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "index.html"), []byte("www"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dst := range []string{"/abs/uploaded", "/file", "/up/escaped"} {
+		if err := comm.Upload(dst, strings.NewReader(dst), nil); err != nil {
+			t.Fatalf("could not upload %s: %s", dst, err)
+		}
+	}
+	for _, dst := range []string{"/abs", "/up"} {
+		if err := comm.UploadDir(dst, src, nil); err != nil {
+			t.Fatalf("could not upload to %s: %s", dst, err)
+		}
+	}
+
+	if got := listFiles(t, host); !reflect.DeepEqual(got, []string{"secret"}) {
+		t.Errorf("expected the host directory to be left untouched, got %v", got)
+	}
+	if b, _ := os.ReadFile(filepath.Join(host, "secret")); string(b) != "host" {
+		t.Errorf("expected the host file to be left untouched, got %q", b)
+	}
+
+	inside := filepath.Join(rootfs, filepath.FromSlash(host))
+	for file, want := range map[string]string{
+		filepath.Join(inside, "uploaded"):       "/abs/uploaded",
+		filepath.Join(inside, "secret"):         "/file",
+		filepath.Join(inside, "www/index.html"): "www",
+		filepath.Join(rootfs, "escaped"):        "/up/escaped",
+		filepath.Join(rootfs, "www/index.html"): "www",
+	} {
+		if b, err := os.ReadFile(file); err != nil || string(b) != want {
+			t.Errorf("expected %s to hold %q, got %q (%v)", file, want, b, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := comm.Download("/file", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "/file" {
+		t.Errorf("expected to download the file of the rootfs, got %q", buf.String())
+	}
+
+	out := t.TempDir()
+	if err := comm.DownloadDir("/abs/", out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, out), []string{"secret", "uploaded", "www/index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected downloaded files %v, got %v", want, got)
+	}
+}
+
+func TestRootfsCommunicator_Start(t *testing.T) {
+	rootfs := filepath.Join(t.TempDir(), "rootfs")
+	comm := &RootfsCommunicator{Path: rootfs}
+	ui := packersdk.TestUi(t)
+
+	if comm.provisioned {
+		t.Error("expected the rootfs not to be provisioned yet")
+	}
+
+	cmd := &packersdk.RemoteCmd{Command: `echo "$ROOTFS" > ./out`}
+	if err := cmd.RunWithUi(context.Background(), comm, ui); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.ExitStatus() != 0 {
+		t.Fatalf("expected exit status 0, got %d", cmd.ExitStatus())
+	}
+
+	b, err := os.ReadFile(filepath.Join(rootfs, "out"))
+	if err != nil {
+		t.Fatalf("expected the command to run in the rootfs: %s", err)
+	}
+	if got := strings.TrimSpace(string(b)); got != rootfs {
+		t.Errorf("expected ROOTFS=%s, got %s", rootfs, got)
+	}
+	if !comm.provisioned {
+		t.Error("expected running a command to provision the rootfs")
+	}
+
+	cmd = &packersdk.RemoteCmd{Command: "exit 3"}
+	if err := cmd.RunWithUi(context.Background(), comm, ui); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.ExitStatus() != 3 {
+		t.Errorf("expected exit status 3, got %d", cmd.ExitStatus())
+	}
+}
+
+func TestStepRootfsCommunicator(t *testing.T) {
+	config := &Config{Rootfs: "/tmp/app/rootfs", RootfsChroot: true}
+	state := testState(t, config, &MockDriver{})
+
+	action := (&StepRootfsCommunicator{}).Run(context.Background(), state)
+	assertAction(t, state, action, multistep.ActionContinue)
+
+	comm, ok := state.Get("communicator").(*RootfsCommunicator)
+	if !ok {
+		t.Fatalf("expected a rootfs communicator, got %T", state.Get("communicator"))
+	}
+	if comm.Path != "/tmp/app/rootfs" || !comm.Chroot {
+		t.Errorf("unexpected communicator %+v", comm)
+	}
+}
+
+// listFiles returns the sorted paths of the files below dir, relative to it.
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		files = append(files, rel)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(files)
+	return files
+}
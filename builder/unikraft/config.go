@@ -1,9 +1,12 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,RegistryAuth
 
 package unikraft
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -15,14 +18,26 @@ import (
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
-	// The architecture to build for. This is required.
-	Architecture string `mapstructure:"architecture" required:"true"`
-	// The platform to build for. This is required.
-	Platform string `mapstructure:"platform" required:"true"`
+	// The architecture to build for. This is required unless all_targets is
+	// set, in which case it filters the targets to build.
+	Architecture string `mapstructure:"architecture"`
+	// The platform to build for. This is required unless all_targets is set,
+	// in which case it filters the targets to build.
+	Platform string `mapstructure:"platform"`
 	// Force a rebuild of the image from scratch.
 	Force bool `mapstructure:"force"`
 	// The name of the image to build.
 	Target string `mapstructure:"target"`
+	// Build every target of the Kraftfile matching the given architecture,
+	// platform and target instead of a single one.
+	AllTargets bool `mapstructure:"all_targets"`
+	// The number of targets to build concurrently when building multiple
+	// targets.  Every target is then built in its own build directory.
+	ParallelTargets int `mapstructure:"parallel_targets"`
+	// Continue building the remaining targets when building a target fails,
+	// reporting all failures at the end.  By default the first failure aborts
+	// all other builds.  Only applies to targets built in parallel.
+	KeepGoing bool `mapstructure:"keep_going"`
 	// The path to the build directory. This is required.
 	Path string `mapstructure:"build_path" required:"true"`
 	// The path to the pull source.
@@ -33,14 +48,125 @@ type Config struct {
 	Sources []string `mapstructure:"sources"`
 	// Unsources the default manifest location for using custom sources.
 	SourcesNoDefault bool `mapstructure:"sources_no_default"`
+	// Do not access the network.  The manifests are not updated, and
+	// packages are only resolved from the manifest mirror, local sources, or
+	// the manifests saved by a previous update.
+	Offline bool `mapstructure:"offline"`
+	// Path to a directory holding an `index.yaml` manifest index, e.g. one
+	// written by vendor_only, to resolve packages from instead of the default
+	// manifests.
+	ManifestMirror string `mapstructure:"manifest_mirror"`
+	// Save the components of the project to vendor_dir instead of building
+	// it, such that vendor_dir can later be used as manifest_mirror.
+	VendorOnly bool `mapstructure:"vendor_only"`
+	// The path to the manifest mirror the components are saved to.  This is
+	// required when vendor_only is set.
+	VendorDir string `mapstructure:"vendor_dir"`
 	// Set of options to set.
+	//
+	// Deprecated: use KConfig instead.
 	Options string `mapstructure:"options"`
+	// KConfig symbols to override for the build, e.g.
+	// `CONFIG_LIBVFSCORE_AUTOMOUNT_EINITRD = "y"`.
+	KConfig map[string]string `mapstructure:"kconfig"`
+	// The number of jobs to run in parallel when building.  By default the
+	// number of jobs is determined from the host.
+	Jobs int `mapstructure:"jobs"`
+	// Use the debuggable (symbolic) kernel image as build result instead of
+	// the stripped image.
+	KernelDbg bool `mapstructure:"kernel_dbg"`
+	// Path to a KConfig `.config` file to use for the build instead of
+	// generating one from the Kraftfile.
+	DotConfig string `mapstructure:"dotconfig"`
+	// Path to the Kraftfile to use, relative to the build path.  By default
+	// the Kraftfile is looked up in the build path.
+	Kraftfile string `mapstructure:"kraftfile"`
+	// Do not run the configure step before building.
+	NoConfigure bool `mapstructure:"no_configure"`
+	// Do not fetch the sources of the components before building.  Sources
+	// are never fetched offline.
+	NoFetch bool `mapstructure:"no_fetch"`
+	// Pull all components again, even if they are available locally.
+	ForcePull bool `mapstructure:"force_pull"`
+	// The path to the root filesystem directory provisioners operate on,
+	// relative to the build path.  When set, or when provisioners ran, it is
+	// archived into the initramfs instead of the rootfs of the Kraftfile.
+	// Defaults to `rootfs` in the build path, and cannot be set with
+	// `rootfs_image`, which is flattened into `.unikraft/rootfs` instead.
+	Rootfs string `mapstructure:"rootfs"`
+	// Run the commands of provisioners chrooted into the rootfs, which
+	// requires root privileges.  By default commands run on the host with the
+	// rootfs as working directory.
+	RootfsChroot bool `mapstructure:"rootfs_chroot"`
+	// Path to an OCI image layout directory or a `docker save` tarball whose
+	// filesystem is flattened into the rootfs before provisioning.  The
+	// entrypoint, command and environment of the image are the defaults of
+	// the arguments and environment of the package.
+	RootfsImage string `mapstructure:"rootfs_image"`
+	// The format of the root filesystem built from the rootfs: `cpio` for an
+	// initramfs loaded into memory, or `erofs` or `ext4` for a filesystem
+	// image to mount as a block volume.  Defaults to `cpio`.
+	RootfsFormat string `mapstructure:"rootfs_format"`
+	// The compression of the root filesystem: `gzip` for `cpio`, or `lz4`,
+	// `lz4hc` or `lzma` for `erofs`.  Not compressed by default.
+	RootfsCompression string `mapstructure:"rootfs_compression"`
+	// Path to a file the build log is saved to.
+	SaveBuildLog string `mapstructure:"save_build_log"`
+	// Path to write a CycloneDX JSON software bill of materials to, listing
+	// the components the kernels were built from.
+	Sbom string `mapstructure:"sbom"`
+	// Path to a lockfile of the resolved components.  It is written on the
+	// first build, and later builds use the locked versions and fail if the
+	// components drift from it.
+	Lockfile string `mapstructure:"lockfile"`
+	// Environment variables to compile into the unikernel.  An empty value
+	// takes the value from the environment of the host.
+	Env map[string]string `mapstructure:"env"`
+	// Credentials of the registries to pull components from.
+	RegistryAuth []RegistryAuth `mapstructure:"registry_auth"`
 	// Log level to use.
 	LogLevel string `mapstructure:"log_level"`
 
+	// rootfsSet tells whether rootfs was set rather than defaulted.
+	rootfsSet bool
+
 	ctx interpolate.Context
 }
 
+// RegistryAuth holds the credentials of a package registry, which are only
+// added to the per-build KraftKit configuration.
+type RegistryAuth struct {
+	// The registry endpoint, e.g. `index.unikraft.io`.
+	Endpoint string `mapstructure:"endpoint" required:"true"`
+	// The user to authenticate as.
+	User string `mapstructure:"user"`
+	// The token or password to authenticate with.
+	Token string `mapstructure:"token"`
+	// Whether to verify the TLS certificate of the registry.  Defaults to
+	// true.
+	VerifySSL *bool `mapstructure:"verify_ssl"`
+}
+
+// Prepare validates the credentials and keeps the token out of the logs.
+func (a *RegistryAuth) Prepare() []error {
+	var errs []error
+
+	if a.Endpoint == "" {
+		errs = append(errs, fmt.Errorf("registry_auth endpoint must be specified"))
+	}
+
+	if a.Token != "" {
+		packer.LogSecretFilter.Set(a.Token)
+	}
+
+	if a.VerifySSL == nil {
+		verify := true
+		a.VerifySSL = &verify
+	}
+
+	return errs
+}
+
 func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 	var md mapstructure.Metadata
 	err := config.Decode(c, &config.DecodeOpts{
@@ -60,11 +186,49 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 
 	// Accumulate any errors
 	var errs *packer.MultiError
-	if c.Architecture == "" {
+	var warnings []string
+
+	if c.Options != "" {
+		warnings = append(warnings, "options is deprecated and will be removed in future releases, use kconfig instead")
+
+		if c.KConfig == nil {
+			c.KConfig = make(map[string]string)
+		}
+
+		for _, option := range strings.Fields(c.Options) {
+			k, v, ok := strings.Cut(option, "=")
+			if !ok || k == "" {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid option %q, expected KEY=value", option))
+				continue
+			}
+
+			// Symbols explicitly given in kconfig take precedence.
+			if _, found := c.KConfig[k]; !found {
+				c.KConfig[k] = v
+			}
+		}
+	}
+
+	kconfigs := make(map[string]string, len(c.KConfig))
+	for k, v := range c.KConfig {
+		if k == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("kconfig symbol names must not be empty"))
+			continue
+		}
+
+		if !strings.HasPrefix(k, "CONFIG_") {
+			k = "CONFIG_" + k
+		}
+
+		kconfigs[k] = v
+	}
+	c.KConfig = kconfigs
+
+	if c.Architecture == "" && !c.AllTargets {
 		errs = packer.MultiErrorAppend(errs, fmt.Errorf("architecture must be specified"))
 	}
 
-	if c.Platform == "" {
+	if c.Platform == "" && !c.AllTargets {
 		errs = packer.MultiErrorAppend(errs, fmt.Errorf("platform must be specified"))
 	}
 
@@ -72,9 +236,137 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		errs = packer.MultiErrorAppend(errs, fmt.Errorf("build_path must be specified"))
 	}
 
+	if c.Jobs < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("jobs must not be negative"))
+	}
+
+	if c.DotConfig != "" {
+		if c.DotConfig, err = filepath.Abs(c.DotConfig); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve dotconfig: %s", err))
+		} else if info, err := os.Stat(c.DotConfig); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("dotconfig %s does not exist: %s", c.DotConfig, err))
+		} else if info.IsDir() {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("dotconfig %s is a directory", c.DotConfig))
+		}
+	}
+
+	// The Kraftfile is only available upfront when the project is not pulled.
+	if c.Kraftfile != "" && c.Path != "" && c.PullSource == "" {
+		kraftfile := c.Kraftfile
+		if !filepath.IsAbs(kraftfile) {
+			kraftfile = filepath.Join(c.Path, kraftfile)
+		}
+
+		if info, err := os.Stat(kraftfile); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("kraftfile %s does not exist: %s", kraftfile, err))
+		} else if info.IsDir() {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("kraftfile %s is a directory", kraftfile))
+		}
+	}
+
+	if c.RootfsImage != "" {
+		if c.RootfsImage, err = filepath.Abs(c.RootfsImage); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve rootfs_image: %s", err))
+		} else if _, err := os.Stat(c.RootfsImage); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("rootfs_image %s does not exist: %s", c.RootfsImage, err))
+		}
+
+		// The image replaces the contents of the rootfs, so it is only
+		// flattened into a directory owned by the plugin.
+		if c.Rootfs != "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("rootfs cannot be set with rootfs_image, which is flattened into %s of build_path", imageRootfsDir("")))
+		}
+	}
+
+	if c.RootfsFormat == "" {
+		c.RootfsFormat = RootfsFormatCpio
+	}
+
+	if err := checkRootfsFormat(c.RootfsFormat, c.RootfsCompression); err != nil {
+		errs = packer.MultiErrorAppend(errs, err)
+	}
+
+	c.rootfsSet = c.Rootfs != ""
+
+	if c.Path != "" {
+		if c.RootfsImage != "" {
+			c.Rootfs = imageRootfsDir(c.Path)
+		} else if c.Rootfs == "" {
+			c.Rootfs = "rootfs"
+		}
+
+		if !filepath.IsAbs(c.Rootfs) {
+			c.Rootfs = filepath.Join(c.Path, c.Rootfs)
+		}
+	}
+
+	if c.SaveBuildLog != "" {
+		if c.SaveBuildLog, err = filepath.Abs(c.SaveBuildLog); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve save_build_log: %s", err))
+		}
+	}
+
+	if c.ManifestMirror != "" {
+		if c.ManifestMirror, err = filepath.Abs(c.ManifestMirror); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve manifest_mirror: %s", err))
+		} else if _, err := os.Stat(filepath.Join(c.ManifestMirror, "index.yaml")); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("manifest_mirror %s holds no index.yaml: %s", c.ManifestMirror, err))
+		}
+	}
+
+	if c.VendorOnly && c.VendorDir == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("vendor_dir must be specified with vendor_only"))
+	}
+
+	if c.VendorDir != "" {
+		if c.VendorDir, err = filepath.Abs(c.VendorDir); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve vendor_dir: %s", err))
+		}
+	}
+
+	if c.Offline {
+		for _, source := range c.Sources {
+			if strings.Contains(source, "://") {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("source %s cannot be used offline, only local paths are", source))
+			}
+		}
+	}
+
+	if c.Sbom != "" {
+		if c.Sbom, err = filepath.Abs(c.Sbom); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve sbom: %s", err))
+		}
+	}
+
+	if c.Lockfile != "" {
+		if c.Lockfile, err = filepath.Abs(c.Lockfile); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve lockfile: %s", err))
+		}
+	}
+
+	for k := range c.Env {
+		if k == "" || strings.ContainsRune(k, '=') {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid environment variable name %q", k))
+		}
+	}
+
+	for i := range c.RegistryAuth {
+		errs = packer.MultiErrorAppend(errs, c.RegistryAuth[i].Prepare()...)
+	}
+
+	if c.ParallelTargets < 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("parallel_targets must not be negative"))
+	} else if c.ParallelTargets > 1 && !c.AllTargets {
+		warnings = append(warnings, "parallel_targets has no effect unless all_targets is set")
+	}
+
+	if c.KeepGoing && c.ParallelTargets < 2 {
+		warnings = append(warnings, "keep_going has no effect unless parallel_targets is greater than 1")
+	}
+
 	if errs != nil && len(errs.Errors) > 0 {
-		return nil, errs
+		return warnings, errs
 	}
 
-	return nil, nil
+	return warnings, nil
 }
@@ -10,25 +10,50 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
-	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
-	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
-	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
-	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
-	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
-	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
-	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	Architecture        *string           `mapstructure:"architecture" required:"true" cty:"architecture" hcl:"architecture"`
-	Platform            *string           `mapstructure:"platform" required:"true" cty:"platform" hcl:"platform"`
-	Force               *bool             `mapstructure:"force" cty:"force" hcl:"force"`
-	Target              *string           `mapstructure:"target" cty:"target" hcl:"target"`
-	Path                *string           `mapstructure:"build_path" required:"true" cty:"build_path" hcl:"build_path"`
-	PullSource          *string           `mapstructure:"pull_source" cty:"pull_source" hcl:"pull_source"`
-	Workdir             *string           `mapstructure:"workdir" cty:"workdir" hcl:"workdir"`
-	Sources             []string          `mapstructure:"sources" cty:"sources" hcl:"sources"`
-	SourcesNoDefault    *bool             `mapstructure:"sources_no_default" cty:"sources_no_default" hcl:"sources_no_default"`
-	Options             *string           `mapstructure:"options" cty:"options" hcl:"options"`
-	LogLevel            *string           `mapstructure:"log_level" cty:"log_level" hcl:"log_level"`
+	PackerBuildName     *string            `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string            `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string            `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool              `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool              `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string            `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string  `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string           `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Architecture        *string            `mapstructure:"architecture" cty:"architecture" hcl:"architecture"`
+	Platform            *string            `mapstructure:"platform" cty:"platform" hcl:"platform"`
+	Force               *bool              `mapstructure:"force" cty:"force" hcl:"force"`
+	Target              *string            `mapstructure:"target" cty:"target" hcl:"target"`
+	AllTargets          *bool              `mapstructure:"all_targets" cty:"all_targets" hcl:"all_targets"`
+	ParallelTargets     *int               `mapstructure:"parallel_targets" cty:"parallel_targets" hcl:"parallel_targets"`
+	KeepGoing           *bool              `mapstructure:"keep_going" cty:"keep_going" hcl:"keep_going"`
+	Path                *string            `mapstructure:"build_path" required:"true" cty:"build_path" hcl:"build_path"`
+	PullSource          *string            `mapstructure:"pull_source" cty:"pull_source" hcl:"pull_source"`
+	Workdir             *string            `mapstructure:"workdir" cty:"workdir" hcl:"workdir"`
+	Sources             []string           `mapstructure:"sources" cty:"sources" hcl:"sources"`
+	SourcesNoDefault    *bool              `mapstructure:"sources_no_default" cty:"sources_no_default" hcl:"sources_no_default"`
+	Offline             *bool              `mapstructure:"offline" cty:"offline" hcl:"offline"`
+	ManifestMirror      *string            `mapstructure:"manifest_mirror" cty:"manifest_mirror" hcl:"manifest_mirror"`
+	VendorOnly          *bool              `mapstructure:"vendor_only" cty:"vendor_only" hcl:"vendor_only"`
+	VendorDir           *string            `mapstructure:"vendor_dir" cty:"vendor_dir" hcl:"vendor_dir"`
+	Options             *string            `mapstructure:"options" cty:"options" hcl:"options"`
+	KConfig             map[string]string  `mapstructure:"kconfig" cty:"kconfig" hcl:"kconfig"`
+	Jobs                *int               `mapstructure:"jobs" cty:"jobs" hcl:"jobs"`
+	KernelDbg           *bool              `mapstructure:"kernel_dbg" cty:"kernel_dbg" hcl:"kernel_dbg"`
+	DotConfig           *string            `mapstructure:"dotconfig" cty:"dotconfig" hcl:"dotconfig"`
+	Kraftfile           *string            `mapstructure:"kraftfile" cty:"kraftfile" hcl:"kraftfile"`
+	NoConfigure         *bool              `mapstructure:"no_configure" cty:"no_configure" hcl:"no_configure"`
+	NoFetch             *bool              `mapstructure:"no_fetch" cty:"no_fetch" hcl:"no_fetch"`
+	ForcePull           *bool              `mapstructure:"force_pull" cty:"force_pull" hcl:"force_pull"`
+	Rootfs              *string            `mapstructure:"rootfs" cty:"rootfs" hcl:"rootfs"`
+	RootfsChroot        *bool              `mapstructure:"rootfs_chroot" cty:"rootfs_chroot" hcl:"rootfs_chroot"`
+	RootfsImage         *string            `mapstructure:"rootfs_image" cty:"rootfs_image" hcl:"rootfs_image"`
+	RootfsFormat        *string            `mapstructure:"rootfs_format" cty:"rootfs_format" hcl:"rootfs_format"`
+	RootfsCompression   *string            `mapstructure:"rootfs_compression" cty:"rootfs_compression" hcl:"rootfs_compression"`
+	SaveBuildLog        *string            `mapstructure:"save_build_log" cty:"save_build_log" hcl:"save_build_log"`
+	Sbom                *string            `mapstructure:"sbom" cty:"sbom" hcl:"sbom"`
+	Lockfile            *string            `mapstructure:"lockfile" cty:"lockfile" hcl:"lockfile"`
+	Env                 map[string]string  `mapstructure:"env" cty:"env" hcl:"env"`
+	RegistryAuth        []FlatRegistryAuth `mapstructure:"registry_auth" cty:"registry_auth" hcl:"registry_auth"`
+	LogLevel            *string            `mapstructure:"log_level" cty:"log_level" hcl:"log_level"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -55,13 +80,67 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"platform":                   &hcldec.AttrSpec{Name: "platform", Type: cty.String, Required: false},
 		"force":                      &hcldec.AttrSpec{Name: "force", Type: cty.Bool, Required: false},
 		"target":                     &hcldec.AttrSpec{Name: "target", Type: cty.String, Required: false},
+		"all_targets":                &hcldec.AttrSpec{Name: "all_targets", Type: cty.Bool, Required: false},
+		"parallel_targets":           &hcldec.AttrSpec{Name: "parallel_targets", Type: cty.Number, Required: false},
+		"keep_going":                 &hcldec.AttrSpec{Name: "keep_going", Type: cty.Bool, Required: false},
 		"build_path":                 &hcldec.AttrSpec{Name: "build_path", Type: cty.String, Required: false},
 		"pull_source":                &hcldec.AttrSpec{Name: "pull_source", Type: cty.String, Required: false},
 		"workdir":                    &hcldec.AttrSpec{Name: "workdir", Type: cty.String, Required: false},
 		"sources":                    &hcldec.AttrSpec{Name: "sources", Type: cty.List(cty.String), Required: false},
 		"sources_no_default":         &hcldec.AttrSpec{Name: "sources_no_default", Type: cty.Bool, Required: false},
+		"offline":                    &hcldec.AttrSpec{Name: "offline", Type: cty.Bool, Required: false},
+		"manifest_mirror":            &hcldec.AttrSpec{Name: "manifest_mirror", Type: cty.String, Required: false},
+		"vendor_only":                &hcldec.AttrSpec{Name: "vendor_only", Type: cty.Bool, Required: false},
+		"vendor_dir":                 &hcldec.AttrSpec{Name: "vendor_dir", Type: cty.String, Required: false},
 		"options":                    &hcldec.AttrSpec{Name: "options", Type: cty.String, Required: false},
+		"kconfig":                    &hcldec.AttrSpec{Name: "kconfig", Type: cty.Map(cty.String), Required: false},
+		"jobs":                       &hcldec.AttrSpec{Name: "jobs", Type: cty.Number, Required: false},
+		"kernel_dbg":                 &hcldec.AttrSpec{Name: "kernel_dbg", Type: cty.Bool, Required: false},
+		"dotconfig":                  &hcldec.AttrSpec{Name: "dotconfig", Type: cty.String, Required: false},
+		"kraftfile":                  &hcldec.AttrSpec{Name: "kraftfile", Type: cty.String, Required: false},
+		"no_configure":               &hcldec.AttrSpec{Name: "no_configure", Type: cty.Bool, Required: false},
+		"no_fetch":                   &hcldec.AttrSpec{Name: "no_fetch", Type: cty.Bool, Required: false},
+		"force_pull":                 &hcldec.AttrSpec{Name: "force_pull", Type: cty.Bool, Required: false},
+		"rootfs":                     &hcldec.AttrSpec{Name: "rootfs", Type: cty.String, Required: false},
+		"rootfs_chroot":              &hcldec.AttrSpec{Name: "rootfs_chroot", Type: cty.Bool, Required: false},
+		"rootfs_image":               &hcldec.AttrSpec{Name: "rootfs_image", Type: cty.String, Required: false},
+		"rootfs_format":              &hcldec.AttrSpec{Name: "rootfs_format", Type: cty.String, Required: false},
+		"rootfs_compression":         &hcldec.AttrSpec{Name: "rootfs_compression", Type: cty.String, Required: false},
+		"save_build_log":             &hcldec.AttrSpec{Name: "save_build_log", Type: cty.String, Required: false},
+		"sbom":                       &hcldec.AttrSpec{Name: "sbom", Type: cty.String, Required: false},
+		"lockfile":                   &hcldec.AttrSpec{Name: "lockfile", Type: cty.String, Required: false},
+		"env":                        &hcldec.AttrSpec{Name: "env", Type: cty.Map(cty.String), Required: false},
+		"registry_auth":              &hcldec.BlockListSpec{TypeName: "registry_auth", Nested: hcldec.ObjectSpec((*FlatRegistryAuth)(nil).HCL2Spec())},
 		"log_level":                  &hcldec.AttrSpec{Name: "log_level", Type: cty.String, Required: false},
 	}
 	return s
 }
+
+// FlatRegistryAuth is an auto-generated flat version of RegistryAuth.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatRegistryAuth struct {
+	Endpoint  *string `mapstructure:"endpoint" required:"true" cty:"endpoint" hcl:"endpoint"`
+	User      *string `mapstructure:"user" cty:"user" hcl:"user"`
+	Token     *string `mapstructure:"token" cty:"token" hcl:"token"`
+	VerifySSL *bool   `mapstructure:"verify_ssl" cty:"verify_ssl" hcl:"verify_ssl"`
+}
+
+// FlatMapstructure returns a new FlatRegistryAuth.
+// FlatRegistryAuth is an auto-generated flat version of RegistryAuth.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*RegistryAuth) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatRegistryAuth)
+}
+
+// HCL2Spec returns the hcl spec of a RegistryAuth.
+// This spec is used by HCL to read the fields of RegistryAuth.
+// The decoded values from this spec will then be applied to a FlatRegistryAuth.
+func (*FlatRegistryAuth) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"endpoint":   &hcldec.AttrSpec{Name: "endpoint", Type: cty.String, Required: false},
+		"user":       &hcldec.AttrSpec{Name: "user", Type: cty.String, Required: false},
+		"token":      &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"verify_ssl": &hcldec.AttrSpec{Name: "verify_ssl", Type: cty.Bool, Required: false},
+	}
+	return s
+}
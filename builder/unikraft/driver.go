@@ -1,22 +1,225 @@
 package unikraft
 
+import "context"
+
 // Driver is the interface that has to be implemented to communicate with
 // Kraft. The Driver interface also allows the steps to be tested since
 // a mock driver can be shimmed in.
+//
+// Cancelling the context passed to any of the methods aborts the underlying
+// operation, e.g. an in-flight build or pull.
 type Driver interface {
-	Build(path, architecture, platform, target string) error
+	Build(ctx context.Context, opts BuildOptions) ([]BuildResult, error)
 
-	Pkg(architecture, platform, target, pkgName, rootfs, workdir string, push bool) error
+	Pkg(ctx context.Context, opts PackageOptions) error
 
-	Clean(path string) error
+	Clean(ctx context.Context, path string) error
 
-	Pull(source, workdir string) error
+	Pull(ctx context.Context, source, workdir string) error
 
 	Set(options map[string]string) error
 
-	Source(source string) error
+	Unset(options []string) error
+
+	Pin(components []Component) error
+
+	Vendor(ctx context.Context, opts VendorOptions) ([]Component, error)
+
+	Resolve(ctx context.Context, opts ResolveOptions) ([]Component, error)
+
+	Source(ctx context.Context, source string) error
+
+	Unsource(ctx context.Context, source string) error
+
+	Update(ctx context.Context) error
+}
+
+// KraftOptions tunes the KraftKit context created by KraftCommandContext.
+type KraftOptions struct {
+	// Log level of KraftKit, e.g. `info`.
+	LogLevel string
+	// Credentials of package registries.
+	RegistryAuth []RegistryAuth
+	// Do not access the network: the manifests are not updated and no OCI
+	// registry is queried.
+	Offline bool
+	// Path to a directory holding an `index.yaml` manifest index, which is
+	// used instead of the manifests of the configuration.
+	ManifestMirror string
+	// Save the manifests fetched by an update to a temporary directory
+	// instead of the one shared with other builds and the user's KraftKit,
+	// e.g. as they are fetched from other sources.
+	IsolateManifests bool
+}
+
+// BuildOptions tunes how Driver.Build builds a project.
+type BuildOptions struct {
+	// Path to the project to build.
+	Path string
+	// Architecture to build for.
+	Architecture string
+	// Platform to build for.
+	Platform string
+	// Name of the target to build.
+	Target string
+	// Build every matching target instead of a single one.
+	All bool
+	// Number of targets to build concurrently.
+	Parallel int
+	// Continue building the remaining targets when a target fails.
+	KeepGoing bool
+	// Number of make jobs, determined from the host when zero.
+	Jobs int
+	// Return the debuggable kernel image instead of the stripped one.
+	KernelDbg bool
+	// Path to a `.config` file to use instead of generating one.
+	DotConfig string
+	// Path to the Kraftfile, relative to the project path.
+	Kraftfile string
+	// Skip the configure step.
+	NoConfigure bool
+	// Skip fetching the sources of the components.
+	NoFetch bool
+	// Pull all components, even if they are available locally.
+	ForcePull bool
+	// Path to the root filesystem to archive into the initramfs instead of
+	// the rootfs of the Kraftfile.
+	Rootfs string
+	// Format of the root filesystem image, RootfsFormatCpio when empty.
+	RootfsFormat string
+	// Compression of the root filesystem image, none when empty.
+	RootfsCompression string
+	// Path to save the build log to.
+	SaveBuildLog string
+	// Environment variables in the `KEY=value` or `KEY` format.
+	Env []string
+}
+
+// VendorOptions tunes how Driver.Vendor saves the components of a project.
+type VendorOptions struct {
+	// Path to the project to vendor the components of.
+	Path string
+	// Path to the Kraftfile, relative to the project path.
+	Kraftfile string
+	// Architecture to vendor runtime packages for.
+	Architecture string
+	// Platform to vendor runtime packages for.
+	Platform string
+	// Path to the mirror directory the components are saved to.
+	Output string
+}
+
+// ResolveOptions tunes how Driver.Resolve pulls the components of a project.
+type ResolveOptions struct {
+	// Path to the project to resolve the components of.
+	Path string
+	// Path to the Kraftfile, relative to the project path.
+	Kraftfile string
+	// Architecture to pull runtime packages for.
+	Architecture string
+	// Platform to pull runtime packages for.
+	Platform string
+}
+
+// DefaultPackageFormat is the format packages are created in by default.
+const DefaultPackageFormat = "oci"
 
-	Unsource(source string) error
+// Formats of the root filesystem built for the kernels.
+const (
+	RootfsFormatCpio  = "cpio"
+	RootfsFormatErofs = "erofs"
+	RootfsFormatExt4  = "ext4"
+)
+
+// Packagers which can be requested through PackageOptions.Packager.
+const (
+	PackagerKraftfileUnikraft = "kraftfile-unikraft"
+	PackagerKraftfileRuntime  = "kraftfile-runtime"
+	PackagerCliKernel         = "cli-kernel"
+	PackagerDockerfile        = "dockerfile"
+)
+
+// PackageOptions describes how Driver.Pkg packages a project.
+type PackageOptions struct {
+	// Architecture of the kernel to package.
+	Architecture string
+	// Platform of the kernel to package.
+	Platform string
+	// Name of the target to package, mutually exclusive with Architecture and
+	// Platform.
+	Target string
+	// Name of the resulting package, e.g. an OCI image reference.
+	Name string
+	// Path to the project to package.
+	Workdir string
+	// Path to the kernel to package, if it is known upfront.
+	Kernel string
+	// Format of the package, e.g. `oci`.  Defaults to `oci`.
+	Format string
+	// Path to save the package to instead of the local package store.
+	Output string
+	// Labels in the `KEY=value` format.
+	Labels []string
+	// Arguments to pass to the unikernel.
+	Args []string
+	// Environment variables in the `KEY=value` or `KEY` format.
+	Env []string
+	// Runtime to package the kernel with.
+	Runtime string
+	// Merge strategy when the package already exists, e.g. `merge`.
+	Strategy string
+	// Do not include the KConfig of the kernel.
+	NoKConfig bool
+	// Package the debuggable kernel image.
+	Dbg bool
+	// Path to the Kraftfile, relative to Workdir.
+	Kraftfile string
+	// Name of the packager to use, determined from the project when empty.
+	Packager string
+	// Path to the root filesystem to include in the package.
+	Rootfs string
+	// Format of the root filesystem, RootfsFormatCpio when empty.  Root
+	// filesystem images of other formats are included as they are.
+	RootfsFormat string
+	// Push the resulting package to its registry.
+	Push bool
+}
+
+// BuildResult describes a single target built by Driver.Build.
+type BuildResult struct {
+	// Name of the target in the Kraftfile.
+	Target string
+	// Architecture the kernel was built for.
+	Architecture string
+	// Platform the kernel was built for.
+	Platform string
+	// Path to the resulting kernel image.
+	Kernel string
+	// Path to the debuggable kernel image.
+	KernelDbg string
+	// Path to the initramfs built for the target, if any.
+	Initramfs string
+	// Format of the initramfs, e.g. RootfsFormatCpio.
+	RootfsFormat string
+	// Unikraft version the kernel was built with, i.e. `UK_FULLVERSION`.
+	Version string
+	// Components the kernel was built from.
+	Components []Component
+}
 
-	Update() error
+// Component describes a component of a project, e.g. the Unikraft core or a
+// library.
+type Component struct {
+	// Type of the component, e.g. `lib`.
+	Type string `mapstructure:"type"`
+	// Name of the component.
+	Name string `mapstructure:"name"`
+	// Version of the component, e.g. a tag, or the commit checked out for a
+	// branch or channel such as `stable` when the sources are a git
+	// repository.
+	Version string `mapstructure:"version"`
+	// Source the component was retrieved from.
+	Source string `mapstructure:"source"`
+	// Path to the sources of the component.
+	Path string `mapstructure:"path"`
 }
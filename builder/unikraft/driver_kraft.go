@@ -3,9 +3,13 @@ package unikraft
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"kraftkit.sh/packmanager"
+	"kraftkit.sh/unikraft"
+	"kraftkit.sh/unikraft/app"
 )
 
 type KraftDriver struct {
@@ -13,77 +17,303 @@ type KraftDriver struct {
 	Ctx *interpolate.Context
 
 	CommandContext context.Context
+
+	// Offline tells that packages can only be resolved from local manifests.
+	Offline bool
+
+	// kconfig holds the symbols overridden through Set which are passed on to
+	// every subsequent build.
+	kconfig map[string]string
+	// pins holds the component versions pinned through Pin, keyed by the type
+	// and name of the component, which are used by every subsequent pull and
+	// build.
+	pins map[string]string
+}
+
+// commandContext returns a context which carries the KraftKit values of the
+// driver and which is cancelled together with ctx.
+func (d *KraftDriver) commandContext(ctx context.Context) context.Context {
+	return &kraftContext{Context: ctx, values: d.CommandContext}
+}
+
+// kraftContext combines the cancellation of a context, e.g. the one passed by
+// Packer to a step, with the values of the KraftKit command context.
+type kraftContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c *kraftContext) Value(key any) any {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+
+	return c.Context.Value(key)
 }
 
-func (d *KraftDriver) Build(path, architecture, platform, target string) error {
+func (d *KraftDriver) Build(ctx context.Context, opts BuildOptions) ([]BuildResult, error) {
 	c := Build{
-		Architecture: architecture,
-		Platform:     platform,
-		TargetName:   target,
+		All:          opts.All,
+		Architecture: opts.Architecture,
+		DotConfig:    opts.DotConfig,
+		Env:          opts.Env,
+		ForcePull:    opts.ForcePull,
+		Jobs:         opts.Jobs,
+		KeepGoing:    opts.KeepGoing,
+		KernelDbg:    opts.KernelDbg,
+		Kraftfile:    opts.Kraftfile,
 		NoCache:      true,
+		NoConfigure:  opts.NoConfigure,
+		NoFetch:      opts.NoFetch,
 		NoUpdate:     true,
+		Parallel:     opts.Parallel,
+		Platform:     opts.Platform,
+		Rootfs:       opts.Rootfs,
+		SaveBuildLog: opts.SaveBuildLog,
+		TargetName:   opts.Target,
+		Pins:         d.pins,
+		Offline:      d.Offline,
+
+		RootfsFormat:      opts.RootfsFormat,
+		RootfsCompression: opts.RootfsCompression,
+	}
+
+	for k, v := range d.kconfig {
+		c.KConfig = append(c.KConfig, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(c.KConfig)
+
+	if err := c.BuildCmd(d.commandContext(ctx), opts.Path); err != nil {
+		return nil, err
+	}
+
+	var components []Component
+	if c.project != nil {
+		var err error
+		if components, err = projectComponents(d.commandContext(ctx), c.project); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BuildResult, 0, len(c.built))
+	for _, targ := range c.built {
+		kernel := targ.Kernel()
+		if opts.KernelDbg {
+			kernel = targ.KernelDbg()
+		}
+
+		result := BuildResult{
+			Target:       targ.Name(),
+			Architecture: targ.Architecture().Name(),
+			Platform:     targ.Platform().Name(),
+			Kernel:       kernel,
+			KernelDbg:    targ.KernelDbg(),
+			Initramfs:    targ.initramfs,
+			Components:   components,
+		}
+
+		if result.Initramfs != "" {
+			result.RootfsFormat = opts.RootfsFormat
+			if result.RootfsFormat == "" {
+				result.RootfsFormat = RootfsFormatCpio
+			}
+		}
+
+		if version, ok := targ.KConfig().Get(unikraft.UK_FULLVERSION); ok {
+			result.Version = version.Value
+		}
+
+		results = append(results, result)
 	}
-	return c.BuildCmd(d.CommandContext, path)
+
+	return results, nil
 }
 
-func (d *KraftDriver) Pkg(architecture, platform, target, pkgName, workdir, rootfs string, push bool) error {
+func (d *KraftDriver) Pkg(ctx context.Context, opts PackageOptions) error {
+	format := opts.Format
+	if format == "" {
+		format = DefaultPackageFormat
+	}
+
 	c := Pkg{
-		Architecture: architecture,
-		Platform:     platform,
-		Target:       target,
-		Format:       "oci",
-		Name:         pkgName,
-		Push:         push,
-		Rootfs:       rootfs,
+		Architecture: opts.Architecture,
+		Platform:     opts.Platform,
+		Target:       opts.Target,
+		Format:       format,
+		Kernel:       opts.Kernel,
+		Output:       opts.Output,
+		Labels:       opts.Labels,
+		Args:         opts.Args,
+		Env:          opts.Env,
+		Runtime:      opts.Runtime,
+		Strategy:     packmanager.MergeStrategy(opts.Strategy),
+		NoKConfig:    opts.NoKConfig,
+		Dbg:          opts.Dbg,
+		Kraftfile:    opts.Kraftfile,
+		Packager:     opts.Packager,
+		Name:         opts.Name,
+		Push:         opts.Push,
+		Rootfs:       opts.Rootfs,
+		RootfsFormat: opts.RootfsFormat,
+	}
+
+	// Without a project, packaging happens relative to the working directory.
+	var args []string
+	if opts.Workdir != "" {
+		args = append(args, opts.Workdir)
 	}
 
-	_, err := c.PackCmd(d.CommandContext, workdir)
+	_, err := c.PackCmd(d.commandContext(ctx), args...)
 	return err
 }
 
-func (d *KraftDriver) Clean(path string) error {
+func (d *KraftDriver) Clean(ctx context.Context, path string) error {
 	c := Clean{}
 
-	return c.CleanCmd(d.CommandContext, []string{path})
+	return c.CleanCmd(d.commandContext(ctx), []string{path})
 }
 
-func (d *KraftDriver) Pull(source, workdir string) error {
+func (d *KraftDriver) Pull(ctx context.Context, source, workdir string) error {
 	c := Pull{
 		Workdir: workdir,
+		Pins:    d.pins,
+		Offline: d.Offline,
 	}
 
-	return c.PullCmd(d.CommandContext, []string{source})
+	return c.PullCmd(d.commandContext(ctx), []string{source})
 }
 
+// Vendor saves the components of the project, as resolved by a pull, to the
+// manifest mirror in opts.Output instead of the project.
+func (d *KraftDriver) Vendor(ctx context.Context, opts VendorOptions) ([]Component, error) {
+	c := Pull{
+		All:          opts.Architecture == "" || opts.Platform == "",
+		Architecture: opts.Architecture,
+		Platform:     opts.Platform,
+		Kraftfile:    opts.Kraftfile,
+		Workdir:      opts.Path,
+		Pins:         d.pins,
+		Offline:      d.Offline,
+		Vendor:       opts.Output,
+	}
+
+	if err := c.PullCmd(d.commandContext(ctx), []string{opts.Path}); err != nil {
+		return nil, err
+	}
+
+	return c.vendored, nil
+}
+
+// Resolve pulls the components of the project, honouring the pins, and
+// returns them as resolved, such that they can be checked before building.
+func (d *KraftDriver) Resolve(ctx context.Context, opts ResolveOptions) ([]Component, error) {
+	c := Pull{
+		All:          opts.Architecture == "" || opts.Platform == "",
+		Architecture: opts.Architecture,
+		Platform:     opts.Platform,
+		Kraftfile:    opts.Kraftfile,
+		Workdir:      opts.Path,
+		Pins:         d.pins,
+		Offline:      d.Offline,
+	}
+
+	if err := c.PullCmd(d.commandContext(ctx), []string{opts.Path}); err != nil {
+		return nil, err
+	}
+
+	if c.project == nil {
+		return nil, fmt.Errorf("no project found in %s", opts.Path)
+	}
+
+	return projectComponents(d.commandContext(ctx), c.project)
+}
+
+// projectComponents lists the components of the project, with the version
+// their sources resolved to.
+func projectComponents(ctx context.Context, project app.Application) ([]Component, error) {
+	comps, err := project.Components(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list components: %w", err)
+	}
+
+	components := make([]Component, 0, len(comps))
+	for _, comp := range comps {
+		components = append(components, Component{
+			Type:    string(comp.Type()),
+			Name:    comp.Name(),
+			Version: resolvedVersion(ctx, comp.Path(), comp.Version()),
+			Source:  comp.Source(),
+			Path:    comp.Path(),
+		})
+	}
+
+	return components, nil
+}
+
+// Set overrides the given KConfig symbols for all subsequent builds.  The
+// symbols are merged into the project's KConfig when it is configured and are
+// never written back to the Kraftfile.
 func (d *KraftDriver) Set(options map[string]string) error {
-	c := Set{}
-	opts := []string{}
+	if d.kconfig == nil {
+		d.kconfig = make(map[string]string, len(options))
+	}
 
 	for k, v := range options {
-		opts = append(opts, fmt.Sprintf("%s=%s", k, v))
+		if k == "" {
+			return fmt.Errorf("cannot set empty symbol")
+		}
+
+		d.kconfig[k] = v
+	}
+
+	return nil
+}
+
+// Unset removes previously set KConfig symbol overrides.
+func (d *KraftDriver) Unset(options []string) error {
+	for _, k := range options {
+		delete(d.kconfig, k)
+	}
+
+	return nil
+}
+
+// Pin resolves the given components to their exact versions in all subsequent
+// pulls and builds, instead of the versions requested by the Kraftfile.
+func (d *KraftDriver) Pin(components []Component) error {
+	if d.pins == nil {
+		d.pins = make(map[string]string, len(components))
+	}
+
+	for _, c := range components {
+		if c.Name == "" || c.Version == "" {
+			return fmt.Errorf("cannot pin component %q without name and version", c.Type+"/"+c.Name)
+		}
+
+		d.pins[c.Type+"/"+c.Name] = c.Version
 	}
 
-	return c.SetCmd(d.CommandContext, opts)
+	return nil
 }
 
-func (d *KraftDriver) Source(source string) error {
+func (d *KraftDriver) Source(ctx context.Context, source string) error {
 	c := Source{
 		Force: false,
 	}
 
-	return c.SourceCmd(d.CommandContext, []string{source})
+	return c.SourceCmd(d.commandContext(ctx), []string{source})
 }
 
-func (d *KraftDriver) Unsource(source string) error {
+func (d *KraftDriver) Unsource(ctx context.Context, source string) error {
 	c := Unsource{}
 
-	return c.UnsourceCmd(d.CommandContext, []string{source})
+	return c.UnsourceCmd(d.commandContext(ctx), []string{source})
 }
 
-func (d *KraftDriver) Update() error {
+func (d *KraftDriver) Update(ctx context.Context) error {
 	c := Update{
 		Manager: "manifest",
 	}
 
-	return c.UpdateCmd(d.CommandContext, []string{})
+	return c.UpdateCmd(d.commandContext(ctx), []string{})
 }
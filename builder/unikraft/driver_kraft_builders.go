@@ -26,6 +26,7 @@ import (
 	"kraftkit.sh/tui/selection"
 	"kraftkit.sh/unikraft"
 	"kraftkit.sh/unikraft/app"
+	"kraftkit.sh/unikraft/component"
 	"kraftkit.sh/unikraft/export/v0/posixenviron"
 	"kraftkit.sh/unikraft/target"
 )
@@ -84,6 +85,40 @@ func BuildRootfs(ctx context.Context, workdir, rootfs string, compress bool, arc
 	return rootfs, cmds, envs, nil
 }
 
+// buildRootfs builds the root filesystem of the given architecture in the
+// format of the build, and returns its path.
+func (opts *Build) buildRootfs(ctx context.Context, rootfs, arch string) (string, error) {
+	switch opts.RootfsFormat {
+	case "", RootfsFormatCpio:
+		path, _, _, err := BuildRootfs(ctx, opts.workdir, rootfs, opts.RootfsCompression != "", arch)
+		return path, err
+	}
+
+	if rootfs == "" {
+		return "", nil
+	}
+
+	output := filepath.Join(opts.workdir, unikraft.BuildDir, fmt.Sprintf("rootfs-%s.%s", arch, opts.RootfsFormat))
+	if err := buildRootfsImage(ctx, opts.workdir, rootfs, output, opts.RootfsFormat, opts.RootfsCompression); err != nil {
+		return "", fmt.Errorf("could not build %s rootfs: %w", opts.RootfsFormat, err)
+	}
+
+	return output, nil
+}
+
+// buildRootfs archives the root filesystem of the given architecture into an
+// initramfs, and returns its path together with the command and environment
+// of its image, if any.  Root filesystem images of other formats are
+// packaged as they are.
+func (opts *Pkg) buildRootfs(ctx context.Context, rootfs, arch string) (string, []string, []string, error) {
+	switch opts.RootfsFormat {
+	case "", RootfsFormatCpio:
+		return BuildRootfs(ctx, opts.Workdir, rootfs, false, arch)
+	}
+
+	return workdirPath(opts.Workdir, rootfs), nil, nil, nil
+}
+
 type builder interface {
 	fmt.Stringer
 
@@ -173,7 +208,7 @@ func (build *builderKraftfileUnikraft) pull(ctx context.Context, opts *Build, no
 			p, err := packmanager.G(ctx).Catalog(ctx,
 				packmanager.WithName(template.Name()),
 				packmanager.WithTypes(template.Type()),
-				packmanager.WithVersion(template.Version()),
+				packmanager.WithVersion(pinnedVersion(opts.Pins, template)),
 				packmanager.WithSource(template.Source()),
 				packmanager.WithRemote(opts.NoCache),
 				packmanager.WithAuthConfig(auths),
@@ -183,9 +218,7 @@ func (build *builderKraftfileUnikraft) pull(ctx context.Context, opts *Build, no
 			}
 
 			if len(p) == 0 {
-				return fmt.Errorf("could not find: %s",
-					unikraft.TypeNameVersion(template),
-				)
+				return notFoundError(opts.Offline, template)
 			}
 
 			packs = append(packs, p...)
@@ -240,10 +273,26 @@ func (build *builderKraftfileUnikraft) pull(ctx context.Context, opts *Build, no
 		}
 	}
 
-	components, err := opts.project.Components(ctx, opts.Target)
-	if err != nil {
-		return err
+	// Gather the components of every selected target, as each target may
+	// depend on a different set of libraries.
+	var components []component.Component
+	seen := map[string]bool{}
+	for _, targ := range opts.targets {
+		more, err := opts.project.Components(ctx, targ)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range more {
+			if seen[unikraft.TypeNameVersion(c)] {
+				continue
+			}
+
+			seen[unikraft.TypeNameVersion(c)] = true
+			components = append(components, c)
+		}
 	}
+
 	for _, component := range components {
 		// Skip "finding" the component if path is the same as the source (which
 		// means that the source code is already available as it is a directory on
@@ -269,7 +318,7 @@ func (build *builderKraftfileUnikraft) pull(ctx context.Context, opts *Build, no
 		p, err := packmanager.G(ctx).Catalog(ctx,
 			packmanager.WithName(component.Name()),
 			packmanager.WithTypes(component.Type()),
-			packmanager.WithVersion(component.Version()),
+			packmanager.WithVersion(pinnedVersion(opts.Pins, component)),
 			packmanager.WithSource(component.Source()),
 			packmanager.WithRemote(opts.NoCache),
 			packmanager.WithAuthConfig(auths),
@@ -279,9 +328,7 @@ func (build *builderKraftfileUnikraft) pull(ctx context.Context, opts *Build, no
 		}
 
 		if len(p) == 0 {
-			return fmt.Errorf("could not find: %s",
-				unikraft.TypeNameVersion(component),
-			)
+			return notFoundError(opts.Offline, component)
 		} else if len(p) > 1 {
 			return fmt.Errorf("too many options for %s",
 				unikraft.TypeNameVersion(component),
@@ -321,28 +368,35 @@ func (build *builderKraftfileUnikraft) Prepare(ctx context.Context, opts *Build,
 		if len(selected) == 0 {
 			return fmt.Errorf("no targets to build")
 		}
-		if !opts.All {
-			selected = target.Filter(
-				selected,
-				opts.Architecture,
-				opts.Platform,
-				opts.TargetName,
-			)
 
-			if !config.G[config.KraftKit](ctx).NoPrompt && len(selected) > 1 {
-				res, err := target.Select(selected)
-				if err != nil {
-					return err
-				}
-				selected = []target.Target{res}
+		selected = target.Filter(
+			selected,
+			opts.Architecture,
+			opts.Platform,
+			opts.TargetName,
+		)
+
+		if !opts.All && !config.G[config.KraftKit](ctx).NoPrompt && len(selected) > 1 {
+			res, err := target.Select(selected)
+			if err != nil {
+				return err
 			}
+			selected = []target.Target{res}
 		}
 
 		if len(selected) == 0 {
 			return fmt.Errorf("no targets selected to build")
 		}
 
+		// When not building all targets, only the first matching target is built.
+		if !opts.All {
+			selected = selected[:1]
+		}
+
 		opts.Target = selected[0]
+		opts.targets = selected
+	} else if len(opts.targets) == 0 {
+		opts.targets = []target.Target{opts.Target}
 	}
 
 	// Calculate the width of the longest process name so that we can align the
@@ -353,20 +407,22 @@ func (build *builderKraftfileUnikraft) Prepare(ctx context.Context, opts *Build,
 		// additional space characters (2 characters), brackets (2 characters) the
 		// name of the project and the target/plat string (which is variable in
 		// length).
-		if newLen := len((opts.Target).Name()) + len(target.TargetPlatArchName(opts.Target)) + 15; newLen > build.nameWidth {
-			build.nameWidth = newLen
-		}
+		for _, targ := range opts.targets {
+			if newLen := len(targ.Name()) + len(target.TargetPlatArchName(targ)) + 15; newLen > build.nameWidth {
+				build.nameWidth = newLen
+			}
 
-		components, err := opts.project.Components(ctx, opts.Target)
-		if err != nil {
-			return fmt.Errorf("could not get list of components: %w", err)
-		}
+			components, err := opts.project.Components(ctx, targ)
+			if err != nil {
+				return fmt.Errorf("could not get list of components: %w", err)
+			}
 
-		// The longest word is "pulling" (which is 7 characters long),plus
-		// additional space characters (1 character).
-		for _, component := range components {
-			if newLen := len(unikraft.TypeNameVersion(component)) + 8; newLen > build.nameWidth {
-				build.nameWidth = newLen
+			// The longest word is "pulling" (which is 7 characters long),plus
+			// additional space characters (1 character).
+			for _, component := range components {
+				if newLen := len(unikraft.TypeNameVersion(component)) + 8; newLen > build.nameWidth {
+					build.nameWidth = newLen
+				}
 			}
 		}
 	}
@@ -428,22 +484,62 @@ func (build *builderKraftfileUnikraft) Build(ctx context.Context, opts *Build, a
 		counter++
 	}
 
-	err := opts.project.Configure(
-		ctx,
-		opts.Target, // Target-specific options
-		envKconfig,  // Extra Kconfigs for compiled in environment variables
-		make.WithSilent(true),
-		make.WithExecOptions(
-			exec.WithStdin(iostreams.G(ctx).In),
-			exec.WithStdout(log.G(ctx).Writer()),
-			exec.WithStderr(log.G(ctx).WriterLevel(logrus.WarnLevel)),
-		),
-	)
-	if err != nil {
-		return fmt.Errorf("configure failed: %w", err)
+	// Apply any user-provided symbol overrides on top of the project's KConfig.
+	// These are only passed to the configure step, such that the Kraftfile is
+	// left untouched.
+	for _, kv := range opts.KConfig {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid or malformed kconfig option: %s", kv)
+		}
+
+		envKconfig.Set(k, v)
+	}
+
+	// Start from the provided .config file, which is then either used as-is or
+	// completed by the configure step.
+	if len(opts.DotConfig) > 0 {
+		if err := copyFile(opts.DotConfig, filepath.Join(opts.workdir, opts.Target.ConfigFilename())); err != nil {
+			return fmt.Errorf("could not use dotconfig: %w", err)
+		}
+	}
+
+	if !opts.NoConfigure {
+		err := opts.project.Configure(
+			ctx,
+			opts.Target, // Target-specific options
+			envKconfig,  // Extra Kconfigs for compiled in environment variables
+			make.WithSilent(true),
+			make.WithExecOptions(
+				exec.WithStdin(iostreams.G(ctx).In),
+				exec.WithStdout(log.G(ctx).Writer()),
+				exec.WithStderr(log.G(ctx).WriterLevel(logrus.WarnLevel)),
+			),
+		)
+		if err != nil {
+			return fmt.Errorf("configure failed: %w", err)
+		}
+	}
+
+	// Fetching downloads the sources of the libraries, e.g. their upstream
+	// tarballs, which is not possible offline.
+	if !opts.NoFetch && !opts.Offline {
+		err := opts.project.Fetch(
+			ctx,
+			opts.Target, // Target-specific options
+			append(mopts,
+				make.WithExecOptions(
+					exec.WithStdout(log.G(ctx).Writer()),
+					exec.WithStderr(log.G(ctx).WriterLevel(logrus.WarnLevel)),
+				),
+			)...,
+		)
+		if err != nil {
+			return fmt.Errorf("fetch failed: %w", err)
+		}
 	}
 
-	err = opts.project.Build(
+	err := opts.project.Build(
 		ctx,
 		opts.Target, // Target-specific options
 		app.WithBuildMakeOptions(append(mopts,
@@ -511,7 +607,7 @@ func (*builderKraftfileRuntime) Prepare(ctx context.Context, opts *Build, _ ...s
 
 	qopts := []packmanager.QueryOption{
 		packmanager.WithName(name),
-		packmanager.WithVersion(opts.project.Runtime().Version()),
+		packmanager.WithVersion(pinnedVersion(opts.Pins, opts.project.Runtime())),
 	}
 
 	qopts = append(qopts,
@@ -32,6 +32,8 @@ type Build struct {
 	Env          []string
 	ForcePull    bool
 	Jobs         int
+	KConfig      []string
+	KeepGoing    bool
 	KernelDbg    bool
 	Kraftfile    string
 	NoCache      bool
@@ -39,15 +41,31 @@ type Build struct {
 	NoFast       bool
 	NoFetch      bool
 	NoUpdate     bool
+	Parallel     int
 	Platform     string
 	Rootfs       string
 	SaveBuildLog string
 	Target       target.Target
 	TargetName   string
+	// RootfsFormat is the format of the root filesystem, a CPIO initramfs
+	// when empty, and RootfsCompression its compression.
+	RootfsFormat      string
+	RootfsCompression string
+	// Pins holds the versions to use instead of the ones in the Kraftfile,
+	// keyed by the type and name of the component.
+	Pins map[string]string
+	// Offline tells that packages can only be resolved from local manifests.
+	Offline bool
 
 	project    app.Application
 	workdir    string
 	statistics map[string]string
+
+	// targets are all the targets selected for building, of which Target is
+	// the one currently being built.
+	targets []target.Target
+	// built are the targets which have been successfully built.
+	built []builtTarget
 }
 
 func (opts *Build) initProject(ctx context.Context) error {
@@ -120,26 +138,80 @@ func (opts *Build) BuildCmd(ctx context.Context, args ...string) error {
 		return fmt.Errorf("could not complete build: %w", err)
 	}
 
-	if opts.Rootfs, _, _, err = BuildRootfs(ctx, opts.workdir, opts.Rootfs, false, opts.Target.Architecture().String()); err != nil {
-		return err
+	if len(opts.targets) == 0 {
+		opts.targets = []target.Target{opts.Target}
 	}
 
-	// Set the root file system for the project, since typically a packaging step
-	// may occur after a build, and the root file system is required for packaging
-	// and the packaging step may perform a build of the rootfs again.  Ultimately
-	// this prevents re-builds.
-	opts.project.SetRootfs(opts.Rootfs)
+	if opts.Parallel > 1 && len(opts.targets) > 1 {
+		if err := opts.buildParallel(ctx, build, args...); err != nil {
+			return err
+		}
 
-	err = build.Build(ctx, opts, args...)
-	if err != nil {
-		return fmt.Errorf("could not complete build: %w", err)
+		return opts.removeEmptyMakefile()
+	}
+
+	rootfs := opts.Rootfs
+
+	for _, targ := range opts.targets {
+		opts.Target = targ
+
+		if opts.Rootfs, err = opts.buildRootfs(ctx, rootfs, opts.Target.Architecture().String()); err != nil {
+			return err
+		}
+
+		// Set the root file system for the project, since typically a packaging step
+		// may occur after a build, and the root file system is required for packaging
+		// and the packaging step may perform a build of the rootfs again.  Ultimately
+		// this prevents re-builds.
+		opts.project.SetRootfs(opts.Rootfs)
+
+		err = build.Build(ctx, opts, args...)
+		if err != nil {
+			return fmt.Errorf("could not complete build of %s: %w", target.TargetPlatArchName(targ), err)
+		}
+
+		opts.built = append(opts.built, builtTarget{
+			Target:    targ,
+			initramfs: opts.Rootfs,
+		})
 	}
 
-	// NOTE(craciunoiuc): This is currently a workaround to remove empty
-	// Makefile.uk files generated wrongly by the build system. Until this
-	// is fixed we just delete.
-	//
-	// See: https://github.com/unikraft/unikraft/issues/1456
+	return opts.removeEmptyMakefile()
+}
+
+// builtTarget is a target which has been built successfully, together with
+// the initramfs which was built for it, if any.
+type builtTarget struct {
+	target.Target
+	initramfs string
+}
+
+// notFoundError returns the error for a component which no package manager
+// could find.
+func notFoundError(offline bool, c unikraft.Nameable) error {
+	if offline {
+		return fmt.Errorf("could not find: %s offline, check that the manifest mirror provides it", unikraft.TypeNameVersion(c))
+	}
+
+	return fmt.Errorf("could not find: %s", unikraft.TypeNameVersion(c))
+}
+
+// pinnedVersion returns the version of the component pinned in pins, or the
+// version requested by the project if it is not pinned.
+func pinnedVersion(pins map[string]string, c unikraft.Nameable) string {
+	if version, ok := pins[string(c.Type())+"/"+c.Name()]; ok {
+		return version
+	}
+
+	return c.Version()
+}
+
+// NOTE(craciunoiuc): This is currently a workaround to remove empty
+// Makefile.uk files generated wrongly by the build system. Until this
+// is fixed we just delete.
+//
+// See: https://github.com/unikraft/unikraft/issues/1456
+func (opts *Build) removeEmptyMakefile() error {
 	make := filepath.Join(opts.workdir, "Makefile.uk")
 	if finfo, err := os.Stat(make); err == nil && finfo.Size() == 0 {
 		err := os.Remove(make)
@@ -165,10 +237,12 @@ type Pkg struct {
 	NoKConfig    bool
 	NoPull       bool
 	Output       string
+	Packager     string
 	Platform     string
 	Project      app.Application
 	Push         bool
 	Rootfs       string
+	RootfsFormat string
 	Runtime      string
 	Strategy     packmanager.MergeStrategy
 	Target       string
@@ -265,7 +339,7 @@ func (opts *Pkg) PackCmd(ctx context.Context, args ...string) ([]pack.Package, e
 		// Switch the package manager the desired format for this target
 		opts.pm, err = packmanager.G(ctx).From(pack.PackageFormat(opts.Format))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("unsupported package format %q: %w", opts.Format, err)
 		}
 	} else {
 		opts.pm = packmanager.G(ctx)
@@ -318,6 +392,11 @@ func (opts *Pkg) PackCmd(ctx context.Context, args ...string) ([]pack.Package, e
 	// the current context and Kraftfile match specific requirements towards
 	// performing a type of build.
 	for _, candidate := range packagers {
+		// Only consider the packager which was explicitly requested, if any.
+		if len(opts.Packager) > 0 && candidate.String() != opts.Packager {
+			continue
+		}
+
 		log.G(ctx).
 			WithField("packager", candidate.String()).
 			Trace("checking compatibility")
@@ -328,12 +407,20 @@ func (opts *Pkg) PackCmd(ctx context.Context, args ...string) ([]pack.Package, e
 			break
 		}
 
+		if len(opts.Packager) > 0 {
+			return nil, fmt.Errorf("could not package using %s: %w", opts.Packager, err)
+		}
+
 		log.G(ctx).
 			WithError(err).
 			WithField("packager", candidate.String()).
 			Trace("incompatbile")
 	}
 
+	if pkgr == nil && len(opts.Packager) > 0 {
+		return nil, fmt.Errorf("unknown packager %q", opts.Packager)
+	}
+
 	if pkgr == nil {
 		return nil, fmt.Errorf("could not determine what or how to package from the given context")
 	}
@@ -431,15 +518,27 @@ type Pull struct {
 	WithDeps     bool
 	Workdir      string
 	KConfig      []string
+	// Pins holds the versions to use instead of the ones in the Kraftfile,
+	// keyed by the type and name of the component.
+	Pins map[string]string
+	// Offline tells that packages can only be resolved from local manifests.
+	Offline bool
+	// Vendor is the path to a manifest mirror the packages are saved to
+	// instead of being pulled into the project.
+	Vendor string
 
 	update bool
+	// vendored are the components saved to the mirror.
+	vendored []Component
+	// project is the project whose components were pulled, if any.
+	project app.Application
 }
 
 func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 	var err error
 	var project app.Application
 
-	opts.update = true
+	opts.update = !opts.Offline
 
 	if len(opts.Workdir) == 0 {
 		opts.Workdir, err = os.Getwd()
@@ -488,6 +587,10 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 
 	var queries [][]packmanager.QueryOption
 
+	// Templates are pulled into the project in any case, as the components
+	// are only known once the template is merged.
+	var templates []pack.Package
+
 	// Are we pulling an application directory?  If so, interpret the application
 	// so we can get a list of components
 	if f, err := os.Stat(args[0]); err == nil && f.IsDir() {
@@ -518,7 +621,7 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 				qopts := []packmanager.QueryOption{
 					packmanager.WithName(project.Template().Name()),
 					packmanager.WithTypes(unikraft.ComponentTypeApp),
-					packmanager.WithVersion(project.Template().Version()),
+					packmanager.WithVersion(pinnedVersion(opts.Pins, project.Template())),
 					packmanager.WithRemote(opts.update),
 					packmanager.WithPlatform(opts.Platform),
 					packmanager.WithArchitecture(opts.Architecture),
@@ -530,7 +633,7 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 				}
 
 				if len(packages) == 0 {
-					return fmt.Errorf("could not find: %s based on %s", unikraft.TypeNameVersion(project.Template()), packmanager.NewQuery(qopts...).String())
+					return fmt.Errorf("%w based on %s", notFoundError(opts.Offline, project.Template()), packmanager.NewQuery(qopts...).String())
 				}
 
 				if len(packages) == 1 {
@@ -556,10 +659,15 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 					pullPack = *selected
 				}
 
-				return pullPack.Pull(
+				err = pullPack.Pull(
 					ctx,
 					pack.WithPullWorkdir(opts.Output),
 				)
+				if err != nil || opts.Vendor == "" {
+					return err
+				}
+
+				templates = append(templates, pullPack)
 			}
 
 			templateWorkdir, err := unikraft.PlaceComponent(opts.Output, project.Template().Type(), project.Template().Name())
@@ -586,10 +694,11 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 		if err != nil {
 			return err
 		}
+		opts.project = project
 		for _, c := range components {
 			queries = append(queries, []packmanager.QueryOption{
 				packmanager.WithName(c.Name()),
-				packmanager.WithVersion(c.Version()),
+				packmanager.WithVersion(pinnedVersion(opts.Pins, c)),
 				packmanager.WithSource(c.Source()),
 				packmanager.WithTypes(c.Type()),
 				packmanager.WithRemote(opts.update),
@@ -601,7 +710,7 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 		if project.Runtime() != nil {
 			queries = append(queries, []packmanager.QueryOption{
 				packmanager.WithName(project.Runtime().Name()),
-				packmanager.WithVersion(project.Runtime().Version()),
+				packmanager.WithVersion(pinnedVersion(opts.Pins, project.Runtime())),
 				packmanager.WithRemote(opts.update),
 				packmanager.WithPlatform(opts.Platform),
 				packmanager.WithArchitecture(opts.Architecture),
@@ -668,6 +777,10 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 			}
 
 			if len(more) == 0 {
+				if opts.Offline {
+					return fmt.Errorf("could not find %s offline, check that the manifest mirror provides it", query.String())
+				}
+
 				return fmt.Errorf("could not find %s", query.String())
 			}
 
@@ -675,6 +788,10 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 		}
 	}
 
+	if opts.Vendor != "" {
+		return opts.vendorPackages(ctx, append(templates, found...))
+	}
+
 	for _, p := range found {
 		p := p
 		err := p.Pull(
@@ -696,6 +813,62 @@ func (opts *Pull) PullCmd(ctx context.Context, args []string) error {
 	return nil
 }
 
+// vendorPackages saves the packages to the manifest mirror.  Components are
+// pulled to a scratch directory and archived into the mirror, whose index is
+// updated to describe them.  Runtimes, which are OCI packages, are saved to
+// the OCI image layout of the mirror, such that offline builds can resolve
+// them too.
+func (opts *Pull) vendorPackages(ctx context.Context, packages []pack.Package) error {
+	mirror, err := openMirror(opts.Vendor)
+	if err != nil {
+		return err
+	}
+
+	scratch, err := os.MkdirTemp("", "packer-unikraft-vendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	for _, p := range packages {
+		p := p
+		if p.Format().String() != "manifest" {
+			if err := vendorRuntime(ctx, mirror, p); err != nil {
+				return fmt.Errorf("could not vendor %s: %w", p.String(), err)
+			}
+			continue
+		}
+
+		comp := Component{
+			Type:    string(p.Type()),
+			Name:    p.Name(),
+			Version: p.Version(),
+		}
+
+		err := p.Pull(
+			ctx,
+			pack.WithPullWorkdir(scratch),
+			pack.WithPullChecksum(!opts.NoChecksum),
+			pack.WithPullCache(!opts.update),
+		)
+		if err != nil {
+			return err
+		}
+
+		if comp.Path, err = unikraft.PlaceComponent(scratch, p.Type(), p.Name()); err != nil {
+			return err
+		}
+
+		if comp.Path, err = mirror.add(comp); err != nil {
+			return err
+		}
+
+		opts.vendored = append(opts.vendored, comp)
+	}
+
+	return mirror.save()
+}
+
 type Source struct {
 	Force bool
 }
@@ -721,14 +894,13 @@ func (opts *Source) SourceCmd(ctx context.Context, args []string) error {
 			}
 		}
 
+		// The configuration is only updated in memory and never written back to
+		// disk, such that the user's configuration file is left untouched and
+		// concurrent builds do not interfere with each other.
 		config.G[config.KraftKit](ctx).Unikraft.Manifests = append(
 			config.G[config.KraftKit](ctx).Unikraft.Manifests,
 			source,
 		)
-
-		if err := config.M[config.KraftKit](ctx).Write(true); err != nil {
-			return err
-		}
 	}
 
 	return nil
@@ -754,11 +926,8 @@ func (opts *Unsource) UnsourceCmd(ctx context.Context, args []string) error {
 			return nil
 		}
 
+		// See SourceCmd: the change is deliberately kept in memory.
 		config.G[config.KraftKit](ctx).Unikraft.Manifests = manifests
-
-		if err := config.M[config.KraftKit](ctx).Write(false); err != nil {
-			return err
-		}
 	}
 
 	return nil
@@ -3,9 +3,10 @@ package unikraft
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
-	"github.com/rancher/wrangler/pkg/signals"
 	"github.com/sirupsen/logrus"
 	"kraftkit.sh/config"
 	"kraftkit.sh/log"
@@ -22,21 +23,137 @@ func (k *Kraft) Run(ctx context.Context, args []string) error {
 
 // KraftCommandContext returns a context with the Kraft commands registered.
 // It needs to initialise the commands to ensure that internal context functions are called.
-func KraftCommandContext(ui packersdk.Ui, logLevel string) context.Context {
-	ctx := signals.SetupSignalContext()
+//
+// Every call creates a new, ephemeral KraftKit configuration which is layered
+// on top of the user's configuration file, if one exists.  The configuration
+// only lives in memory: sources added or removed during a build are never
+// written back, such that a crashed or parallel build cannot corrupt the
+// user's configuration.
+//
+// The given registry credentials are added to the configuration, taking
+// precedence over those of the same endpoint in the user's configuration.
+//
+// With IsolateManifests, the manifests are saved to a temporary directory,
+// such that manifests fetched from other sources never replace the ones in
+// the shared manifests directory.
+//
+// The runtimes of the manifest mirror are imported into a temporary OCI
+// package store, from which they are resolved as if they had been pulled.
+//
+// In offline mode, packages are only resolved from the manifests of the
+// manifest mirror, or the manifests saved by a previous update, and OCI
+// packages only from the runtimes of the mirror.
+//
+// The returned context is derived from ctx, which is expected to be cancelled
+// by Packer, e.g. on interrupt.  The returned function removes the temporary
+// files of the context and must be called once it is no longer used.
+func KraftCommandContext(ctx context.Context, ui packersdk.Ui, opts KraftOptions) (_ context.Context, cleanup func(), err error) {
+	var tmpdirs []string
+	cleanup = func() {
+		for _, dir := range tmpdirs {
+			os.RemoveAll(dir)
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
 
 	cfg, err := config.NewDefaultKraftKitConfig()
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("could not initialise the default KraftKit configuration: %w", err)
+	}
+
+	var cfgopts []config.ConfigManagerOption[config.KraftKit]
+	cfgfile := config.DefaultConfigFile()
+	if _, err := os.Stat(cfgfile); err == nil {
+		cfgopts = append(cfgopts,
+			config.WithFile[config.KraftKit](cfgfile, false),
+		)
 	}
-	cfg.NoPrompt = true
 
-	cfgm, err := config.NewConfigManager(
-		cfg,
-		config.WithFile[config.KraftKit](config.DefaultConfigFile(), true),
-	)
+	cfgm, err := config.NewConfigManager(cfg, cfgopts...)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("could not load the KraftKit configuration, check that %s is valid: %w", cfgfile, err)
+	}
+
+	// Always override the user's preference after the configuration file has
+	// been fed, as there is nobody to answer a prompt.
+	cfg.NoPrompt = true
+
+	if len(opts.RegistryAuth) > 0 && cfg.Auth == nil {
+		cfg.Auth = make(map[string]config.AuthConfig, len(opts.RegistryAuth))
+	}
+
+	for _, auth := range opts.RegistryAuth {
+		verifySSL := true
+		if auth.VerifySSL != nil {
+			verifySSL = *auth.VerifySSL
+		}
+
+		cfg.Auth[auth.Endpoint] = config.AuthConfig{
+			Endpoint:  auth.Endpoint,
+			User:      auth.User,
+			Token:     auth.Token,
+			VerifySSL: verifySSL,
+		}
+	}
+
+	var runtimes *mirror
+	if opts.ManifestMirror != "" {
+		if _, err := os.Stat(filepath.Join(opts.ManifestMirror, "index.yaml")); err != nil {
+			return nil, nil, fmt.Errorf("manifest mirror %s holds no index.yaml: %w", opts.ManifestMirror, err)
+		}
+
+		// The paths of the mirror are relative to its index, whereas KraftKit
+		// reads them as is, so an absolute copy of the index is used.
+		mirror, err := openMirror(opts.ManifestMirror)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open manifest mirror %s: %w", opts.ManifestMirror, err)
+		}
+
+		dir, err := os.MkdirTemp("", "packer-unikraft-mirror-")
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpdirs = append(tmpdirs, dir)
+
+		index, err := mirror.resolve(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not resolve manifest mirror %s: %w", opts.ManifestMirror, err)
+		}
+
+		cfg.Unikraft.Manifests = []string{index}
+
+		if len(mirror.runtimes) > 0 {
+			dir, err := os.MkdirTemp("", "packer-unikraft-runtimes-")
+			if err != nil {
+				return nil, nil, err
+			}
+			tmpdirs = append(tmpdirs, dir)
+
+			// KraftKit keeps OCI packages in its runtime directory unless
+			// containerd is used.
+			cfg.RuntimeDir = dir
+			cfg.ContainerdAddr = ""
+			runtimes = mirror
+		}
+	} else if opts.Offline {
+		index := filepath.Join(cfg.Paths.Manifests, "index.yaml")
+		if _, err := os.Stat(index); err != nil {
+			return nil, nil, fmt.Errorf("no manifests are available offline in %s, set manifest_mirror or update the manifests while online: %w", cfg.Paths.Manifests, err)
+		}
+	}
+
+	if opts.IsolateManifests {
+		dir, err := os.MkdirTemp("", "packer-unikraft-manifests-")
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpdirs = append(tmpdirs, dir)
+
+		cfg.Paths.Manifests = dir
 	}
 
 	ctx = config.WithConfigManager(ctx, cfgm)
@@ -48,7 +165,7 @@ func KraftCommandContext(ui packersdk.Ui, logLevel string) context.Context {
 	formatter.DisableTimestamp = true
 	logger.Formatter = formatter
 
-	switch logLevel {
+	switch opts.LogLevel {
 	case "trace":
 		logger.Level = logrus.TraceLevel
 	case "debug":
@@ -74,28 +191,63 @@ func KraftCommandContext(ui packersdk.Ui, logLevel string) context.Context {
 	ctx = log.WithLogger(ctx, logger)
 
 	managerConstructors := []func(u *packmanager.UmbrellaManager) error{
-		oci.RegisterPackageManager(),
 		manifest.RegisterPackageManager(),
 	}
 
+	if runtimes != nil {
+		if err := importRuntimes(ctx, runtimes, cfg.RuntimeDir); err != nil {
+			return nil, nil, fmt.Errorf("could not import the runtimes of manifest mirror %s: %w", opts.ManifestMirror, err)
+		}
+	}
+
+	// Offline, OCI packages are only available from the manifest mirror.
+	if !opts.Offline || runtimes != nil {
+		managerConstructors = append(managerConstructors, oci.RegisterPackageManager())
+	}
+
 	err = packmanager.InitUmbrellaManager(ctx, managerConstructors)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("could not initialise the KraftKit package managers, check that %s is writable: %w", cfg.Paths.Manifests, err)
 	}
 
 	ctx, err = packmanager.WithDefaultUmbrellaManagerInContext(ctx)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("could not set up the KraftKit package manager: %w", err)
 	}
-	return ctx
+
+	return ctx, cleanup, nil
 }
 
 // Logger writer that implements the writer interface
 type LoggerWriter struct {
 	ui *packersdk.Ui
+
+	// prefix is prepended to every message, e.g. to tell apart the output of
+	// targets which are built concurrently.
+	prefix string
 }
 
 func (l *LoggerWriter) Write(p []byte) (n int, err error) {
-	(*l.ui).Message(string(p[:len(p)-1]))
+	(*l.ui).Message(l.prefix + string(p[:len(p)-1]))
 	return len(p), nil
 }
+
+// withTargetLogger returns a context whose logger prefixes every message with
+// the given target name.
+func withTargetLogger(ctx context.Context, name string) context.Context {
+	parent := log.G(ctx)
+
+	logger := logrus.New()
+	logger.Formatter = parent.Formatter
+	logger.Level = parent.GetLevel()
+	logger.Out = parent.Out
+
+	if lw, ok := parent.Out.(*LoggerWriter); ok {
+		logger.Out = &LoggerWriter{
+			ui:     lw.ui,
+			prefix: lw.prefix + "[" + name + "] ",
+		}
+	}
+
+	return log.WithLogger(ctx, logger)
+}
@@ -124,7 +124,7 @@ func (p *packagerKraftfileUnikraft) Pack(ctx context.Context, opts *Pkg, args ..
 		) {
 			rootfs = ""
 		} else {
-			if rootfs, cmds, envs, err = BuildRootfs(ctx, opts.Workdir, rootfs, false, targ.Architecture().String()); err != nil {
+			if rootfs, cmds, envs, err = opts.buildRootfs(ctx, rootfs, targ.Architecture().String()); err != nil {
 				return nil, fmt.Errorf("could not build rootfs: %w", err)
 			}
 		}
@@ -420,7 +420,7 @@ func (p *packagerKraftfileRuntime) Pack(ctx context.Context, opts *Pkg, args ...
 
 	var cmds []string
 	var envs []string
-	if opts.Rootfs, cmds, envs, err = BuildRootfs(ctx, opts.Workdir, opts.Rootfs, false, targ.Architecture().String()); err != nil {
+	if opts.Rootfs, cmds, envs, err = opts.buildRootfs(ctx, opts.Rootfs, targ.Architecture().String()); err != nil {
 		return nil, fmt.Errorf("could not build rootfs: %w", err)
 	}
 
@@ -540,7 +540,7 @@ func (p *packagerCliKernel) Pack(ctx context.Context, opts *Pkg, args ...string)
 
 	var cmds []string
 	var envs []string
-	if opts.Rootfs, cmds, envs, err = BuildRootfs(ctx, opts.Workdir, opts.Rootfs, false, targ.Architecture().String()); err != nil {
+	if opts.Rootfs, cmds, envs, err = opts.buildRootfs(ctx, opts.Rootfs, targ.Architecture().String()); err != nil {
 		return nil, fmt.Errorf("could not build rootfs: %w", err)
 	}
 
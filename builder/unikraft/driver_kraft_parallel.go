@@ -0,0 +1,180 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"kraftkit.sh/unikraft"
+	"kraftkit.sh/unikraft/app"
+	"kraftkit.sh/unikraft/target"
+)
+
+// buildParallel builds all selected targets concurrently using at most
+// opts.Parallel workers.  Every target is built from its own instance of the
+// project with a dedicated build directory, such that the builds do not
+// interfere with each other.
+//
+// Unless opts.KeepGoing is set, the first failure cancels all other builds and
+// is returned.  Otherwise all builds run to completion and every failure is
+// returned.
+func (opts *Build) buildParallel(ctx context.Context, build builder, args ...string) error {
+	// Targets of the same architecture share the same initramfs, so build
+	// these upfront rather than racing on the same output file.
+	rootfs := map[string]string{}
+	for _, targ := range opts.targets {
+		arch := targ.Architecture().String()
+		if _, ok := rootfs[arch]; ok {
+			continue
+		}
+
+		path, err := opts.buildRootfs(ctx, opts.Rootfs, arch)
+		if err != nil {
+			return err
+		}
+
+		rootfs[arch] = path
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errs  []error
+		sem   = make(chan struct{}, opts.Parallel)
+		built = make([]builtTarget, len(opts.targets))
+	)
+
+	for i, targ := range opts.targets {
+		wg.Add(1)
+
+		go func(i int, targ target.Target) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			res, err := opts.buildTarget(ctx, build, targ, rootfs[targ.Architecture().String()], args...)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("could not complete build of %s: %w", target.TargetPlatArchName(targ), err))
+				mu.Unlock()
+
+				if !opts.KeepGoing {
+					cancel()
+				}
+
+				return
+			}
+
+			built[i] = builtTarget{
+				Target:    res,
+				initramfs: rootfs[targ.Architecture().String()],
+			}
+		}(i, targ)
+	}
+
+	wg.Wait()
+
+	for _, targ := range built {
+		if targ.Target != nil {
+			opts.built = append(opts.built, targ)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	// The remaining errors are the result of cancelling the other builds.
+	if !opts.KeepGoing {
+		return errs[0]
+	}
+
+	return errors.Join(errs...)
+}
+
+// buildTarget builds a single target in its own build directory and returns
+// the target as known by the dedicated project instance.
+func (opts *Build) buildTarget(ctx context.Context, build builder, targ target.Target, rootfs string, args ...string) (target.Target, error) {
+	project, err := opts.targetProject(ctx, filepath.Join(opts.workdir, unikraft.BuildDir, targ.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	matches := target.Filter(
+		project.Targets(),
+		targ.Architecture().Name(),
+		targ.Platform().Name(),
+		targ.Name(),
+	)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("could not find target %s", targ.Name())
+	}
+
+	project.SetRootfs(rootfs)
+
+	topts := *opts
+	topts.project = project
+	topts.Target = matches[0]
+	topts.Rootfs = rootfs
+	topts.statistics = map[string]string{}
+
+	// Do not let concurrent builds write to the same log file.
+	if len(topts.SaveBuildLog) > 0 {
+		topts.SaveBuildLog = fmt.Sprintf("%s.%s", topts.SaveBuildLog, targ.Name())
+	}
+
+	if err := build.Build(withTargetLogger(ctx, targ.Name()), &topts, args...); err != nil {
+		return nil, err
+	}
+
+	return topts.Target, nil
+}
+
+// targetProject initializes a new instance of the project which outputs into
+// the given build directory.  Any template has already been pulled during
+// preparation and is merged again.
+func (opts *Build) targetProject(ctx context.Context, outDir string) (app.Application, error) {
+	popts := []app.ProjectOption{
+		app.WithProjectWorkdir(opts.workdir),
+		app.WithProjectOutDir(outDir),
+	}
+
+	if len(opts.Kraftfile) > 0 {
+		popts = append(popts, app.WithProjectKraftfile(opts.Kraftfile))
+	} else {
+		popts = append(popts, app.WithProjectDefaultKraftfiles())
+	}
+
+	project, err := app.NewProjectFromOptions(ctx, popts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if template := project.Template(); template != nil {
+		templateProject, err := app.NewProjectFromOptions(ctx,
+			app.WithProjectWorkdir(template.Path()),
+			app.WithProjectDefaultKraftfiles(),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// Overwrite template with user options
+		project, err = project.MergeTemplate(ctx, templateProject)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return project, nil
+}
@@ -0,0 +1,107 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"kraftkit.sh/config"
+	"kraftkit.sh/oci/handler"
+	"kraftkit.sh/pack"
+)
+
+// defaultRuntimeRegistry is the registry of runtimes whose name does not
+// include one, as for KraftKit.
+const defaultRuntimeRegistry = "index.unikraft.io"
+
+// runtimeReference returns the fully qualified reference of the runtime.
+func runtimeReference(rt mirrorRuntime) (name.Reference, error) {
+	return name.ParseReference(rt.ref(), name.WithDefaultRegistry(defaultRuntimeRegistry))
+}
+
+// kraftKeychain authenticates to registries with the credentials of the
+// KraftKit configuration, falling back to those of Docker.
+type kraftKeychain map[string]config.AuthConfig
+
+func (k kraftKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	if auth, ok := k[r.RegistryStr()]; ok {
+		return authn.FromConfig(authn.AuthConfig{
+			Username: auth.User,
+			Password: auth.Token,
+		}), nil
+	}
+
+	return authn.DefaultKeychain.Resolve(r)
+}
+
+// vendorRuntime saves the runtime with the images of all its platforms to the
+// OCI image layout of the mirror.
+func vendorRuntime(ctx context.Context, m *mirror, p pack.Package) error {
+	rt := newMirrorRuntime(p.Name(), p.Version())
+
+	ref, err := runtimeReference(rt)
+	if err != nil {
+		return err
+	}
+
+	desc, err := remote.Get(ref,
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(kraftKeychain(config.G[config.KraftKit](ctx).Auth)),
+	)
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", ref, err)
+	}
+
+	var img mutate.Appendable
+	if desc.MediaType.IsIndex() {
+		img, err = desc.ImageIndex()
+	} else {
+		img, err = desc.Image()
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.addRuntime(rt, img)
+}
+
+// importRuntimes saves the runtimes of the mirror to the OCI package store of
+// KraftKit at dir, from which they are resolved as if they had been pulled.
+func importRuntimes(ctx context.Context, m *mirror, dir string) error {
+	store, err := handler.NewDirectoryHandler(dir, nil)
+	if err != nil {
+		return err
+	}
+
+	src := dirSource(m.runtimesLayout())
+
+	for _, rt := range m.sortedRuntimes() {
+		ref, err := runtimeReference(rt)
+		if err != nil {
+			return err
+		}
+
+		blobs, err := m.runtimeBlobs(rt)
+		if err != nil {
+			return err
+		}
+
+		for _, desc := range blobs {
+			r, err := src.open(imageBlob(desc.Digest))
+			if err != nil {
+				return err
+			}
+
+			err = store.SaveDescriptor(ctx, ref.Name(), desc, r, nil)
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("could not import %s: %w", rt.ref(), err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,90 +1,132 @@
 package unikraft
 
-type MockDriver struct {
-	BuildCalled       bool
-	BuildPath         string
-	BuildArchitecture string
-	BuildPlatform     string
-	BuildTarget       string
+import "context"
 
-	PkgCalled       bool
-	PkgArchitecture string
-	PkgPlatform     string
-	PkgTarget       string
-	PkgPush         bool
+var _ Driver = (*MockDriver)(nil)
 
-	CleanCalled bool
-	CleanPath   string
+// MockCall records a single invocation of a MockDriver method.
+type MockCall struct {
+	Method string
+	Args   []interface{}
+}
 
-	PullCalled  bool
-	PullSource  string
-	PullWorkdir string
+// MockDriver is a Driver which does not call KraftKit, but records the calls
+// it receives and returns the configured results and errors.
+type MockDriver struct {
+	// Calls holds every call made to the driver, in order.
+	Calls []MockCall
+
+	BuildResults []BuildResult
+	BuildErr     error
+
+	PkgErr      error
+	CleanErr    error
+	PullErr     error
+	SourceErr   error
+	UnsourceErr error
+	UpdateErr   error
+	SetErr      error
+	UnsetErr    error
+	PinErr      error
+
+	VendorComponents []Component
+	VendorErr        error
+
+	ResolveComponents []Component
+	ResolveErr        error
+}
 
-	SourceCalled bool
-	SourceSource string
+func (d *MockDriver) record(method string, args ...interface{}) {
+	d.Calls = append(d.Calls, MockCall{Method: method, Args: args})
+}
 
-	UnsourceCalled bool
-	UnsourceSource string
+// CallCount returns how many times the given method was called.
+func (d *MockDriver) CallCount(method string) int {
+	count := 0
+	for _, call := range d.Calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
 
-	UpdateCalled bool
+// LastArgs returns the arguments of the last call of the given method, or
+// nil if it was not called.
+func (d *MockDriver) LastArgs(method string) []interface{} {
+	for i := len(d.Calls) - 1; i >= 0; i-- {
+		if d.Calls[i].Method == method {
+			return d.Calls[i].Args
+		}
+	}
+	return nil
+}
 
-	SetCalled  bool
-	SetOptions map[string]string
+func (d *MockDriver) Build(_ context.Context, opts BuildOptions) ([]BuildResult, error) {
+	d.record("Build", opts)
+	if d.BuildErr != nil {
+		return nil, d.BuildErr
+	}
+	return d.BuildResults, nil
+}
 
-	UnsetCalled  bool
-	UnsetOptions []string
+func (d *MockDriver) Pkg(_ context.Context, opts PackageOptions) error {
+	d.record("Pkg", opts)
+	return d.PkgErr
 }
 
-func (d *MockDriver) Build(path, architecture, platform, target string) error {
-	d.BuildCalled = true
-	d.BuildPath = path
-	d.BuildArchitecture = architecture
-	d.BuildPlatform = platform
-	d.BuildTarget = target
-	return nil
+func (d *MockDriver) Clean(_ context.Context, path string) error {
+	d.record("Clean", path)
+	return d.CleanErr
 }
 
-func (d *MockDriver) Pkg(architecture, platform, target, pkgName string, push bool) error {
-	d.PkgArchitecture = architecture
-	d.PkgPlatform = platform
-	d.PkgTarget = target
-	d.PkgCalled = true
-	d.PkgPush = push
-	return nil
+func (d *MockDriver) Pull(_ context.Context, source, workdir string) error {
+	d.record("Pull", source, workdir)
+	return d.PullErr
 }
 
-func (d *MockDriver) Clean(path string) error {
-	d.CleanCalled = true
-	d.CleanPath = path
-	return nil
+func (d *MockDriver) Source(_ context.Context, source string) error {
+	d.record("Source", source)
+	return d.SourceErr
 }
 
-func (d *MockDriver) Pull(source, workdir string) error {
-	d.PullCalled = true
-	d.PullSource = source
-	d.PullWorkdir = workdir
-	return nil
+func (d *MockDriver) Unsource(_ context.Context, source string) error {
+	d.record("Unsource", source)
+	return d.UnsourceErr
 }
 
-func (d *MockDriver) Source(source string) error {
-	d.SourceCalled = true
-	d.SourceSource = source
-	return nil
+func (d *MockDriver) Update(_ context.Context) error {
+	d.record("Update")
+	return d.UpdateErr
 }
 
-func (d *MockDriver) Unsource(source string) error {
-	d.UnsourceCalled = true
-	d.UnsourceSource = source
-	return nil
+func (d *MockDriver) Set(options map[string]string) error {
+	d.record("Set", options)
+	return d.SetErr
 }
 
-func (d *MockDriver) Update() error {
-	d.UpdateCalled = true
-	return nil
+func (d *MockDriver) Unset(options []string) error {
+	d.record("Unset", options)
+	return d.UnsetErr
 }
 
-func (d *MockDriver) Set(options map[string]string) error {
-	d.SetCalled = true
-	d.SetOptions = options
-	return nil
+func (d *MockDriver) Pin(components []Component) error {
+	d.record("Pin", components)
+	return d.PinErr
+}
+
+func (d *MockDriver) Vendor(_ context.Context, opts VendorOptions) ([]Component, error) {
+	d.record("Vendor", opts)
+	if d.VendorErr != nil {
+		return nil, d.VendorErr
+	}
+	return d.VendorComponents, nil
+}
+
+func (d *MockDriver) Resolve(_ context.Context, opts ResolveOptions) ([]Component, error) {
+	d.record("Resolve", opts)
+	if d.ResolveErr != nil {
+		return nil, d.ResolveErr
+	}
+	return d.ResolveComponents, nil
 }
@@ -0,0 +1,511 @@
+package unikraft
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// Media types of images pulled or saved by Docker.
+	dockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// Prefixes of the files marking deletions within a layer.
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	// maxSymlinks is the number of symlinks followed when resolving a path
+	// within the rootfs, as for path resolution by Linux.
+	maxSymlinks = 40
+)
+
+// imageSource gives access to the files of an OCI image layout directory or
+// of a `docker save` tarball.
+type imageSource interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+// dirSource is an image extracted to a directory, e.g. an OCI image layout.
+type dirSource string
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+name))))
+}
+
+// tarSource is an image saved to a tarball, e.g. by `docker save`.  The
+// tarball is read again for every file, such that it is never extracted.
+type tarSource string
+
+func (t tarSource) open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(string(t))
+	if err != nil {
+		return nil, err
+	}
+
+	name = path.Clean("/" + name)
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, fmt.Errorf("%s holds no %s: %w", t, name, fs.ErrNotExist)
+		} else if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		if hdr.Typeflag == tar.TypeReg && path.Clean("/"+hdr.Name) == name {
+			return readCloser{Reader: tr, Closer: f}, nil
+		}
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// dockerManifestEntry is an image listed in the `manifest.json` of a
+// `docker save` tarball.
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// flattenImage writes the filesystem of the image at path, an OCI image
+// layout directory or a `docker save` tarball, to the directory dst by
+// applying its layers in order, and returns the configuration of the image.
+// Of an image index, the image for the given architecture is used.
+func flattenImage(imagePath, arch, dst string) (ocispec.ImageConfig, error) {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return ocispec.ImageConfig{}, err
+	}
+
+	var src imageSource = tarSource(imagePath)
+	if info.IsDir() {
+		src = dirSource(imagePath)
+	}
+
+	image, layers, err := readImage(src, arch)
+	if err != nil {
+		return ocispec.ImageConfig{}, fmt.Errorf("could not read image %s: %w", imagePath, err)
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return ocispec.ImageConfig{}, err
+	}
+
+	// Directories are kept writable while layers are applied, and get the
+	// mode of the last layer setting them once all layers are applied.
+	modes := map[string]fs.FileMode{}
+
+	for _, layer := range layers {
+		if err := applyLayer(src, layer, dst, modes); err != nil {
+			return ocispec.ImageConfig{}, fmt.Errorf("could not apply layer %s: %w", layer, err)
+		}
+	}
+
+	dirs := make([]string, 0, len(modes))
+	for dir := range modes {
+		dirs = append(dirs, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	for _, dir := range dirs {
+		if err := os.Chmod(dir, modes[dir]); err != nil {
+			return ocispec.ImageConfig{}, err
+		}
+	}
+
+	return image.Config, nil
+}
+
+// readImage returns the configuration and the paths of the layers of the
+// image, from the `manifest.json` of a `docker save` tarball or from the
+// `index.json` of an OCI image layout.
+func readImage(src imageSource, arch string) (ocispec.Image, []string, error) {
+	var image ocispec.Image
+
+	var entries []dockerManifestEntry
+	err := readJSON(src, "manifest.json", &entries)
+	if err == nil {
+		if len(entries) == 0 {
+			return image, nil, fmt.Errorf("manifest.json lists no images")
+		}
+		if len(entries) > 1 {
+			log.Printf("[WARN] image holds %d images, using the first one %v", len(entries), entries[0].RepoTags)
+		}
+
+		if err := readJSON(src, entries[0].Config, &image); err != nil {
+			return image, nil, err
+		}
+
+		return image, entries[0].Layers, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return image, nil, err
+	}
+
+	var index ocispec.Index
+	if err := readJSON(src, ocispec.ImageIndexFile, &index); errors.Is(err, fs.ErrNotExist) {
+		return image, nil, fmt.Errorf("neither an OCI image layout nor a docker save tarball")
+	} else if err != nil {
+		return image, nil, err
+	}
+
+	desc, err := selectImage(src, index.Manifests, ociArchitecture(arch))
+	if err != nil {
+		return image, nil, err
+	}
+
+	var manifest ocispec.Manifest
+	if err := readBlob(src, desc.Digest, &manifest); err != nil {
+		return image, nil, err
+	}
+
+	if err := readBlob(src, manifest.Config.Digest, &image); err != nil {
+		return image, nil, err
+	}
+
+	layers := make([]string, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		if err := layer.Digest.Validate(); err != nil {
+			return image, nil, err
+		}
+
+		layers = append(layers, imageBlob(layer.Digest))
+	}
+
+	return image, layers, nil
+}
+
+// selectImage returns the first image manifest for the architecture of the
+// given descriptors, descending into nested indexes.  Without architecture,
+// the first image manifest is returned.
+func selectImage(src imageSource, descs []ocispec.Descriptor, arch string) (ocispec.Descriptor, error) {
+	for _, desc := range descs {
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageManifest, dockerManifest:
+			// Attestations are stored as images of an unknown platform.
+			if desc.Platform != nil && (desc.Platform.Architecture == "unknown" ||
+				(arch != "" && desc.Platform.Architecture != arch)) {
+				continue
+			}
+
+			return desc, nil
+
+		case ocispec.MediaTypeImageIndex, dockerManifestList:
+			var index ocispec.Index
+			if err := readBlob(src, desc.Digest, &index); err != nil {
+				return desc, err
+			}
+
+			if nested, err := selectImage(src, index.Manifests, arch); err == nil {
+				return nested, nil
+			}
+		}
+	}
+
+	if arch != "" {
+		return ocispec.Descriptor{}, fmt.Errorf("no image for the %s architecture", arch)
+	}
+
+	return ocispec.Descriptor{}, fmt.Errorf("no image")
+}
+
+// ociArchitecture returns the name of the architecture in OCI platforms.
+func ociArchitecture(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "arm64", "aarch64":
+		return "arm64"
+	}
+
+	return arch
+}
+
+// imageBlob returns the path of the blob with the given digest in an OCI
+// image layout.
+func imageBlob(d digest.Digest) string {
+	return path.Join(ocispec.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+// readBlob decodes the JSON blob with the given digest.
+func readBlob(src imageSource, d digest.Digest, v interface{}) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+
+	return readJSON(src, imageBlob(d), v)
+}
+
+// readJSON decodes the JSON file of the image with the given name.
+func readJSON(src imageSource, name string, v interface{}) error {
+	r, err := src.open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("could not parse %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// decompress returns a reader of the uncompressed layer, which may be
+// compressed using gzip or zstd.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// applyLayer extracts the layer over dst.  Whiteout files delete the files
+// of lower layers they mark, and device files are skipped as they cannot be
+// created without privileges.  The modes of the directories of the layer are
+// recorded in modes rather than applied.
+func applyLayer(src imageSource, layer, dst string, modes map[string]fs.FileMode) error {
+	r, err := src.open(layer)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dr, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	// Paths added by the layer, which opaque whiteouts must keep.
+	added := map[string]bool{}
+
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+
+		dir, base := path.Split(name)
+
+		if base == whiteoutOpaque {
+			if err := removeChildren(dst, path.Clean(dir), added, modes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			target, err := rootfsPath(dst, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			forgetModes(modes, target)
+			continue
+		}
+
+		target, err := rootfsPath(dst, name)
+		if err != nil {
+			return err
+		}
+
+		added[name] = true
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		// Replace what lower layers put at the path, unless both are
+		// directories.
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			forgetModes(modes, target)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			modes[target] = hdr.FileInfo().Mode().Perm()
+
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			source, err := rootfsPath(dst, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+
+		default:
+			log.Printf("[WARN] skipping %s of type %c in layer %s", name, hdr.Typeflag, layer)
+		}
+	}
+}
+
+// removeChildren removes the entries of the directory dir of the rootfs,
+// except for those added by the current layer.
+func removeChildren(root, dir string, added map[string]bool, modes map[string]fs.FileMode) error {
+	target, err := rootfsPath(root, dir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if added[path.Join(dir, entry.Name())] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+		forgetModes(modes, filepath.Join(target, entry.Name()))
+	}
+
+	return nil
+}
+
+// forgetModes drops the recorded modes of the removed path and of the paths
+// below it.
+func forgetModes(modes map[string]fs.FileMode, removed string) {
+	for dir := range modes {
+		if dir == removed || strings.HasPrefix(dir, removed+string(filepath.Separator)) {
+			delete(modes, dir)
+		}
+	}
+}
+
+// rootfsPath returns the host path of name within the rootfs at root.
+// Symlinks of the parent directories are resolved as if root was the root
+// directory, such that layers cannot write outside of the rootfs.  The last
+// element of the path is not resolved.
+func rootfsPath(root, name string) (string, error) {
+	return resolveRootfsPath(root, name, false)
+}
+
+// resolveRootfsPath returns the host path of name within the rootfs at root,
+// resolving its symlinks as if root was the root directory.  The last
+// element of the path is only resolved if followLast is set.
+func resolveRootfsPath(root, name string, followLast bool) (string, error) {
+	parts := strings.Split(path.Clean("/"+name), "/")
+	current := "/"
+	links := 0
+
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = path.Dir(current)
+			continue
+		}
+
+		next := path.Join(current, part)
+		if len(parts) == 0 && !followLast {
+			current = next
+			break
+		}
+
+		fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links in %s", name)
+		}
+
+		link, err := os.Readlink(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(link) {
+			current = "/"
+		}
+
+		parts = append(strings.Split(link, "/"), parts...)
+	}
+
+	return filepath.Join(root, filepath.FromSlash(current)), nil
+}
@@ -0,0 +1,305 @@
+package unikraft
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testEntry is a file of a test layer.
+type testEntry struct {
+	name     string
+	typeflag byte
+	mode     int64
+	body     string
+	link     string
+}
+
+func testLayer(t *testing.T, compress bool, entries ...testEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     e.mode,
+			Size:     int64(len(e.body)),
+			Linkname: e.link,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !compress {
+		return buf.Bytes()
+	}
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	if _, err := gw.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return gz.Bytes()
+}
+
+var testImageConfig = ocispec.ImageConfig{
+	Entrypoint: []string{"/usr/bin/sh"},
+	Cmd:        []string{"-c", "echo hello"},
+	Env:        []string{"PATH=/usr/bin"},
+}
+
+func testLayers(t *testing.T) [][]byte {
+	return [][]byte{
+		testLayer(t, false,
+			testEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+			testEntry{name: "etc/passwd", typeflag: tar.TypeReg, mode: 0644, body: "root:x:0:0::/:/usr/bin/sh"},
+			testEntry{name: "etc/old", typeflag: tar.TypeReg, mode: 0644, body: "old"},
+			testEntry{name: "var/cache/a", typeflag: tar.TypeReg, mode: 0644, body: "a"},
+			testEntry{name: "usr/bin/sh", typeflag: tar.TypeReg, mode: 0755, body: "sh"},
+			testEntry{name: "usr/lib/", typeflag: tar.TypeDir, mode: 0755},
+			testEntry{name: "lib", typeflag: tar.TypeSymlink, link: "usr/lib"},
+			testEntry{name: "escape", typeflag: tar.TypeSymlink, link: "../../.."},
+		),
+		testLayer(t, true,
+			testEntry{name: "./etc/.wh.old", typeflag: tar.TypeReg},
+			testEntry{name: "var/cache/b", typeflag: tar.TypeReg, mode: 0644, body: "b"},
+			testEntry{name: "var/cache/.wh..wh..opq", typeflag: tar.TypeReg},
+			testEntry{name: "escape/evil", typeflag: tar.TypeReg, mode: 0644, body: "evil"},
+			testEntry{name: "lib/libc.so", typeflag: tar.TypeReg, mode: 0755, body: "libc"},
+			testEntry{name: "usr/bin/ls", typeflag: tar.TypeLink, link: "usr/bin/sh"},
+			testEntry{name: "ro/", typeflag: tar.TypeDir, mode: 0555},
+			testEntry{name: "ro/file", typeflag: tar.TypeReg, mode: 0444, body: "ro"},
+			testEntry{name: "dev/null", typeflag: tar.TypeChar, mode: 0666},
+		),
+	}
+}
+
+// writeBlobFile writes the blob to the OCI image layout and returns its
+// descriptor.
+func writeBlobFile(t *testing.T, layout, mediaType string, b []byte) ocispec.Descriptor {
+	t.Helper()
+
+	d := digest.FromBytes(b)
+	path := filepath.Join(layout, filepath.FromSlash(imageBlob(d)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return ocispec.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(b))}
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// testOCILayout writes an OCI image layout holding an index with an empty
+// arm64 image and the amd64 test image.
+func testOCILayout(t *testing.T) string {
+	layout := t.TempDir()
+
+	image := writeBlobFile(t, layout, ocispec.MediaTypeImageConfig, mustJSON(t, ocispec.Image{Config: testImageConfig}))
+	empty := writeBlobFile(t, layout, ocispec.MediaTypeImageConfig, mustJSON(t, ocispec.Image{}))
+
+	var layers []ocispec.Descriptor
+	for _, layer := range testLayers(t) {
+		layers = append(layers, writeBlobFile(t, layout, ocispec.MediaTypeImageLayerGzip, layer))
+	}
+
+	amd64 := writeBlobFile(t, layout, ocispec.MediaTypeImageManifest, mustJSON(t, ocispec.Manifest{Config: image, Layers: layers}))
+	amd64.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := writeBlobFile(t, layout, ocispec.MediaTypeImageManifest, mustJSON(t, ocispec.Manifest{Config: empty}))
+	arm64.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64"}
+
+	index := writeBlobFile(t, layout, ocispec.MediaTypeImageIndex, mustJSON(t, ocispec.Index{Manifests: []ocispec.Descriptor{arm64, amd64}}))
+
+	b := mustJSON(t, ocispec.Index{Manifests: []ocispec.Descriptor{index}})
+	if err := os.WriteFile(filepath.Join(layout, ocispec.ImageIndexFile), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return layout
+}
+
+// testDockerArchive writes a `docker save` tarball of the test image.
+func testDockerArchive(t *testing.T) string {
+	files := map[string][]byte{
+		"config.json": mustJSON(t, ocispec.Image{Config: testImageConfig}),
+	}
+	manifest := dockerManifestEntry{Config: "config.json", RepoTags: []string{"app:latest"}}
+	for i, layer := range testLayers(t) {
+		name := filepath.Join(string(rune('a'+i)), "layer.tar")
+		files[name] = layer
+		manifest.Layers = append(manifest.Layers, name)
+	}
+	files["manifest.json"] = mustJSON(t, []dockerManifestEntry{manifest})
+
+	var entries []testEntry
+	for _, name := range []string{"config.json", "a/layer.tar", "b/layer.tar", "manifest.json"} {
+		entries = append(entries, testEntry{name: name, typeflag: tar.TypeReg, mode: 0644, body: string(files[name])})
+	}
+
+	path := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(path, testLayer(t, false, entries...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFlattenImage(t *testing.T) {
+	tests := map[string]func(t *testing.T) string{
+		"oci layout":     testOCILayout,
+		"docker archive": testDockerArchive,
+	}
+
+	for name, image := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "a", "b", "rootfs")
+			t.Cleanup(func() { os.Chmod(filepath.Join(dst, "ro"), 0755) })
+
+			config, err := flattenImage(image(t), "x86_64", dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(config, testImageConfig) {
+				t.Errorf("expected config %+v, got %+v", testImageConfig, config)
+			}
+
+			files := []string{"escape", "etc/passwd", "evil", "lib", "ro/file", "usr/bin/ls", "usr/bin/sh", "usr/lib/libc.so", "var/cache/b"}
+			if got := listFiles(t, dst); !reflect.DeepEqual(got, files) {
+				t.Errorf("expected files %v, got %v", files, got)
+			}
+
+			if _, err := os.Lstat(filepath.Join(dst, "..", "..", "..", "evil")); err == nil {
+				t.Error("expected the layer not to write outside of the rootfs")
+			}
+
+			info, err := os.Stat(filepath.Join(dst, "ro"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0555 {
+				t.Errorf("expected ro to have mode 0555, got %s", info.Mode())
+			}
+
+			sh, err := os.Stat(filepath.Join(dst, "usr", "bin", "sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ls, err := os.Stat(filepath.Join(dst, "usr", "bin", "ls"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(sh, ls) {
+				t.Error("expected usr/bin/ls to be a hard link to usr/bin/sh")
+			}
+		})
+	}
+}
+
+func TestFlattenImage_Architecture(t *testing.T) {
+	if _, err := flattenImage(testOCILayout(t), "riscv64", t.TempDir()); err == nil {
+		t.Error("expected an error for an architecture without image")
+	}
+
+	config, err := flattenImage(testOCILayout(t), "arm64", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Entrypoint != nil {
+		t.Errorf("expected the arm64 image, got %+v", config)
+	}
+}
+
+func TestStepRootfsImage(t *testing.T) {
+	path := t.TempDir()
+	rootfs := imageRootfsDir(path)
+	if err := os.MkdirAll(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootfs, "stale"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(rootfs, "ro"), 0755) })
+
+	config := &Config{
+		Path:         path,
+		Architecture: "x86_64",
+		Rootfs:       rootfs,
+		RootfsImage:  testDockerArchive(t),
+	}
+	state := testState(t, config, &MockDriver{})
+
+	action := (&StepRootfsImage{}).Run(context.Background(), state)
+	assertAction(t, state, action, multistep.ActionContinue)
+
+	if _, err := os.Stat(filepath.Join(rootfs, "stale")); err == nil {
+		t.Error("expected the rootfs to be replaced by the image")
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "etc", "passwd")); err != nil {
+		t.Errorf("expected the image to be flattened into the rootfs: %s", err)
+	}
+
+	if args, want := state.Get("image_args"), []string{"/usr/bin/sh", "-c", "echo hello"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("expected image args %v, got %v", want, args)
+	}
+	if env, want := state.Get("image_env"), []string{"PATH=/usr/bin"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("expected image env %v, got %v", want, env)
+	}
+
+	image := config.RootfsImage
+	config.RootfsImage = filepath.Join(t.TempDir(), "missing.tar")
+	state = testState(t, config, &MockDriver{})
+
+	action = (&StepRootfsImage{}).Run(context.Background(), state)
+	assertAction(t, state, action, multistep.ActionHalt)
+
+	// A directory named by the user is never replaced.
+	if err := os.WriteFile(filepath.Join(path, "Kraftfile"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.RootfsImage = image
+	config.Rootfs = path
+	state = testState(t, config, &MockDriver{})
+
+	action = (&StepRootfsImage{}).Run(context.Background(), state)
+	assertAction(t, state, action, multistep.ActionHalt)
+
+	if _, err := os.Stat(filepath.Join(path, "Kraftfile")); err != nil {
+		t.Errorf("expected the build path to be left untouched: %s", err)
+	}
+}
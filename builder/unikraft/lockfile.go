@@ -0,0 +1,180 @@
+package unikraft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LockfileVersion is the version of the lockfile format.
+const LockfileVersion = 1
+
+// Lockfile records the components a project was built from, such that later
+// builds use the exact same versions.
+type Lockfile struct {
+	Version    int               `json:"version"`
+	Components []LockedComponent `json:"components"`
+}
+
+// LockedComponent is a component resolved in a lockfile.
+type LockedComponent struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Source  string `json:"source,omitempty"`
+	// Hex encoded SHA-256 digest over the sources of the component.
+	Digest string `json:"digest,omitempty"`
+}
+
+func (c LockedComponent) ref() string {
+	return c.Type + "/" + c.Name
+}
+
+// newLockfile locks the resolved components of a project.
+func newLockfile(components []Component) (*Lockfile, error) {
+	lock := &Lockfile{Version: LockfileVersion}
+	seen := map[string]bool{}
+
+	for _, comp := range components {
+		locked := LockedComponent{
+			Type:    comp.Type,
+			Name:    comp.Name,
+			Version: comp.Version,
+			Source:  comp.Source,
+		}
+
+		if seen[locked.ref()] {
+			continue
+		}
+		seen[locked.ref()] = true
+
+		if comp.Path != "" {
+			digest, err := dirDigest(comp.Path)
+			if err != nil {
+				return nil, fmt.Errorf("could not checksum %s: %w", locked.ref(), err)
+			}
+
+			locked.Digest = digest
+		}
+
+		lock.Components = append(lock.Components, locked)
+	}
+
+	sort.Slice(lock.Components, func(i, j int) bool {
+		return lock.Components[i].ref() < lock.Components[j].ref()
+	})
+
+	return lock, nil
+}
+
+// resolvedVersion returns the commit checked out in the sources at path if
+// they are a git repository, as branches and channels such as `stable` move
+// over time, or version otherwise.
+func resolvedVersion(ctx context.Context, path, version string) string {
+	if path == "" {
+		return version
+	}
+
+	// Sources without their own repository may lie within the one of the
+	// project, whose commit says nothing about them.
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return version
+	}
+
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return version
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// readLockfile reads the lockfile at path.
+func readLockfile(path string) (*Lockfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock Lockfile
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	if lock.Version != LockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d in %s", lock.Version, path)
+	}
+
+	return &lock, nil
+}
+
+// write writes the lockfile to path.
+func (l *Lockfile) write(path string) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// pins returns the locked components to pin the versions of.
+func (l *Lockfile) pins() []Component {
+	components := make([]Component, 0, len(l.Components))
+	for _, c := range l.Components {
+		components = append(components, Component{
+			Type:    c.Type,
+			Name:    c.Name,
+			Version: c.Version,
+			Source:  c.Source,
+		})
+	}
+
+	return components
+}
+
+// drift returns an error listing every difference between the locked
+// components and the components resolved by a build, if any.
+func (l *Lockfile) drift(resolved *Lockfile) error {
+	locked := make(map[string]LockedComponent, len(l.Components))
+	for _, c := range l.Components {
+		locked[c.ref()] = c
+	}
+
+	var diffs []string
+	for _, c := range resolved.Components {
+		want, ok := locked[c.ref()]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s is not locked", c.ref()))
+			continue
+		}
+		delete(locked, c.ref())
+
+		if c.Version != want.Version {
+			diffs = append(diffs, fmt.Sprintf("%s has version %s, locked %s", c.ref(), c.Version, want.Version))
+		}
+		if want.Digest != "" && c.Digest != want.Digest {
+			diffs = append(diffs, fmt.Sprintf("%s has digest %s, locked %s", c.ref(), c.Digest, want.Digest))
+		}
+	}
+
+	for ref := range locked {
+		diffs = append(diffs, fmt.Sprintf("%s is locked but no longer used", ref))
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	sort.Strings(diffs)
+	return fmt.Errorf("components drifted from the lockfile:\n  %s", strings.Join(diffs, "\n  "))
+}
@@ -0,0 +1,394 @@
+package unikraft
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mirrorIndex is the manifest index of a mirror, in the format read by
+// KraftKit's manifest package manager.
+type mirrorIndex struct {
+	Name        string            `yaml:"name,omitempty"`
+	LastUpdated time.Time         `yaml:"last_updated"`
+	Manifests   []*mirrorManifest `yaml:"manifests"`
+
+	// Runtimes are not read by KraftKit, which resolves them from its OCI
+	// package store.
+	Runtimes []mirrorRuntime `yaml:"runtimes,omitempty"`
+}
+
+// mirrorManifest describes the archives of a single component.  Within the
+// index only the type, name and path of the manifest are set.
+type mirrorManifest struct {
+	Type     string          `yaml:"type"`
+	Name     string          `yaml:"name"`
+	Manifest string          `yaml:"manifest,omitempty"`
+	Origin   string          `yaml:"origin,omitempty"`
+	Channels []mirrorVersion `yaml:"channels,omitempty"`
+	Versions []mirrorVersion `yaml:"versions,omitempty"`
+}
+
+// mirrorVersion is a channel or version of a component in a manifest.
+type mirrorVersion struct {
+	Name     string `yaml:"name,omitempty"`
+	Version  string `yaml:"version,omitempty"`
+	Default  bool   `yaml:"default,omitempty"`
+	Resource string `yaml:"resource"`
+	Sha256   string `yaml:"sha256"`
+}
+
+// mirrorChannels are the versions which KraftKit resolves as channels rather
+// than as tags or commits.
+var mirrorChannels = []string{"stable", "staging"}
+
+// mirror is a directory holding archives of components together with a
+// manifest index describing them, usable as manifest_mirror.  Runtimes are
+// held in an OCI image layout within the mirror and listed in the index.
+type mirror struct {
+	path      string
+	manifests map[string]*mirrorManifest
+	runtimes  map[string]*mirrorRuntime
+}
+
+// openMirror opens the mirror at path, reading the manifests it already holds
+// such that components are added to them.
+func openMirror(path string) (*mirror, error) {
+	m := &mirror{
+		path:      path,
+		manifests: map[string]*mirrorManifest{},
+		runtimes:  map[string]*mirrorRuntime{},
+	}
+
+	b, err := os.ReadFile(filepath.Join(path, "index.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var index mirrorIndex
+	if err := yaml.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("could not parse the index of %s: %w", path, err)
+	}
+
+	for _, entry := range index.Manifests {
+		manifest := entry
+		if entry.Manifest != "" {
+			path := m.abs(entry.Manifest)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			manifest = &mirrorManifest{}
+			if err := yaml.Unmarshal(b, manifest); err != nil {
+				return nil, fmt.Errorf("could not parse %s: %w", path, err)
+			}
+		}
+
+		// Resources are kept absolute while the mirror is open.
+		for _, versions := range [][]mirrorVersion{manifest.Channels, manifest.Versions} {
+			for i := range versions {
+				versions[i].Resource = m.abs(versions[i].Resource)
+			}
+		}
+
+		m.manifests[manifest.Type+"/"+manifest.Name] = manifest
+	}
+
+	for i := range index.Runtimes {
+		rt := index.Runtimes[i]
+		m.runtimes[rt.ref()] = &rt
+	}
+
+	return m, nil
+}
+
+// abs returns the path, relative to the mirror, as an absolute path.  URLs
+// and absolute paths are returned as is.
+func (m *mirror) abs(path string) string {
+	if path == "" || filepath.IsAbs(path) || strings.Contains(path, "://") {
+		return path
+	}
+
+	return filepath.Join(m.path, filepath.FromSlash(path))
+}
+
+// rel returns the absolute path relative to the mirror.  URLs are returned
+// as is.
+func (m *mirror) rel(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	rel, err := filepath.Rel(m.path, path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// add archives the sources of the component, found at its path, into the
+// mirror and returns the path of the archive.  An archive of the same version
+// of the component is replaced.
+func (m *mirror) add(comp Component) (string, error) {
+	version := comp.Version
+	if version == "" {
+		version = mirrorChannels[0]
+	}
+
+	archive := filepath.Join(m.path, comp.Type, comp.Name, strings.ReplaceAll(version, "/", "-")+".tar.gz")
+
+	sum, err := archiveSources(comp.Path, archive, comp.Name+"-"+strings.ReplaceAll(version, "/", "-"))
+	if err != nil {
+		return "", fmt.Errorf("could not archive %s/%s: %w", comp.Type, comp.Name, err)
+	}
+
+	ref := comp.Type + "/" + comp.Name
+	manifest, ok := m.manifests[ref]
+	if !ok {
+		manifest = &mirrorManifest{Type: comp.Type, Name: comp.Name}
+		m.manifests[ref] = manifest
+	}
+	if comp.Source != "" {
+		manifest.Origin = comp.Source
+	}
+
+	entry := mirrorVersion{Resource: archive, Sha256: sum}
+	for _, channel := range mirrorChannels {
+		if version == channel {
+			entry.Name = version
+			entry.Default = version == mirrorChannels[0]
+			manifest.Channels = setMirrorVersion(manifest.Channels, entry)
+			return archive, nil
+		}
+	}
+
+	entry.Version = version
+	manifest.Versions = setMirrorVersion(manifest.Versions, entry)
+
+	return archive, nil
+}
+
+// setMirrorVersion replaces the channel or version in versions, or appends it
+// if it is new.
+func setMirrorVersion(versions []mirrorVersion, entry mirrorVersion) []mirrorVersion {
+	for i, v := range versions {
+		if v.Name == entry.Name && v.Version == entry.Version {
+			versions[i] = entry
+			return versions
+		}
+	}
+
+	return append(versions, entry)
+}
+
+// save writes the manifest of every component next to its archives, and the
+// index listing them.  Paths are relative to the directory of the index, such
+// that the mirror can be moved, e.g. checked into the repository of a
+// project.
+func (m *mirror) save() error {
+	return m.write(m.path, true)
+}
+
+// resolve writes the manifests and index of the mirror to dir with absolute
+// paths, as KraftKit reads them as is, and returns the path of the index.
+func (m *mirror) resolve(dir string) (string, error) {
+	if err := m.write(dir, false); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "index.yaml"), nil
+}
+
+// write writes the manifests and the index to dir, with paths relative to it
+// or absolute.
+func (m *mirror) write(dir string, relative bool) error {
+	refs := make([]string, 0, len(m.manifests))
+	for ref := range m.manifests {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	index := mirrorIndex{
+		Name:        filepath.Base(m.path),
+		LastUpdated: time.Now().UTC(),
+	}
+
+	for _, ref := range refs {
+		manifest := *m.manifests[ref]
+		manifest.Manifest = ""
+
+		if relative {
+			var err error
+			if manifest.Channels, err = m.relVersions(manifest.Channels); err != nil {
+				return err
+			}
+			if manifest.Versions, err = m.relVersions(manifest.Versions); err != nil {
+				return err
+			}
+		}
+
+		name := manifest.Type + "/" + manifest.Name + ".yaml"
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := writeYaml(file, &manifest); err != nil {
+			return err
+		}
+
+		if !relative {
+			name = file
+		}
+
+		index.Manifests = append(index.Manifests, &mirrorManifest{
+			Type:     manifest.Type,
+			Name:     manifest.Name,
+			Manifest: name,
+		})
+	}
+
+	if relative {
+		index.Runtimes = m.sortedRuntimes()
+	}
+
+	return writeYaml(filepath.Join(dir, "index.yaml"), index)
+}
+
+// relVersions returns a copy of the versions with resources relative to the
+// mirror.
+func (m *mirror) relVersions(versions []mirrorVersion) ([]mirrorVersion, error) {
+	if versions == nil {
+		return nil, nil
+	}
+
+	rel := make([]mirrorVersion, len(versions))
+	for i, v := range versions {
+		var err error
+		if v.Resource, err = m.rel(v.Resource); err != nil {
+			return nil, err
+		}
+		rel[i] = v
+	}
+
+	return rel, nil
+}
+
+// writeYaml writes v as YAML to path.
+func writeYaml(path string, v interface{}) error {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0644)
+}
+
+// archiveSources writes the files of dir to a gzip compressed tarball at
+// path, below the given top-level directory as in the release archives of
+// components, and returns its hex encoded SHA-256 digest.  Git metadata is
+// left out, and ownership and modification times are cleared such that the
+// same sources give the same archive.
+func archiveSources(dir, path, prefix string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	gw := gzip.NewWriter(io.MultiWriter(f, h))
+	tw := tar.NewWriter(gw)
+
+	err = filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+		hdr.Uid, hdr.Gid = 0, 0
+		hdr.Uname, hdr.Gname = "", ""
+		hdr.Format = tar.FormatPAX
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,186 @@
+package unikraft
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// mirrorRuntimesDir is the OCI image layout of a mirror holding its runtimes.
+const mirrorRuntimesDir = "oci"
+
+// mirrorRuntime is a runtime, i.e. an OCI package, held in the OCI image
+// layout of a mirror, where it is tagged with its reference.
+type mirrorRuntime struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Digest  string `yaml:"digest"`
+}
+
+// newMirrorRuntime returns the runtime of the given name and version, which
+// defaults to the latest.
+func newMirrorRuntime(name, version string) mirrorRuntime {
+	if version == "" {
+		version = "latest"
+	}
+
+	return mirrorRuntime{Name: name, Version: version}
+}
+
+// ref returns the reference of the runtime, as tagged in the OCI image
+// layout.
+func (r mirrorRuntime) ref() string {
+	if strings.Contains(r.Version, ":") {
+		return r.Name + "@" + r.Version
+	}
+
+	return r.Name + ":" + r.Version
+}
+
+// runtimesLayout returns the path of the OCI image layout of the mirror.
+func (m *mirror) runtimesLayout() string {
+	return filepath.Join(m.path, mirrorRuntimesDir)
+}
+
+// addRuntime writes the runtime, an OCI image or image index, to the OCI
+// image layout of the mirror.  A runtime of the same name and version is
+// replaced, and the blobs only it referenced are removed.
+func (m *mirror) addRuntime(rt mirrorRuntime, img mutate.Appendable) error {
+	d, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	rt.Digest = d.String()
+
+	l, err := layout.FromPath(m.runtimesLayout())
+	if os.IsNotExist(err) {
+		l, err = layout.Write(m.runtimesLayout(), empty.Index)
+	}
+	if err != nil {
+		return fmt.Errorf("could not open the OCI image layout of %s: %w", m.path, err)
+	}
+
+	matcher := match.Annotation(ocispec.AnnotationRefName, rt.ref())
+	annotations := layout.WithAnnotations(map[string]string{
+		ocispec.AnnotationRefName: rt.ref(),
+	})
+
+	switch img := img.(type) {
+	case v1.ImageIndex:
+		err = l.ReplaceIndex(img, matcher, annotations)
+	case v1.Image:
+		err = l.ReplaceImage(img, matcher, annotations)
+	default:
+		err = fmt.Errorf("neither an image nor an image index")
+	}
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", rt.ref(), err)
+	}
+
+	unused, err := l.GarbageCollect()
+	if err != nil {
+		return err
+	}
+	for _, h := range unused {
+		if err := l.RemoveBlob(h); err != nil {
+			return err
+		}
+	}
+
+	m.runtimes[rt.ref()] = &rt
+
+	return nil
+}
+
+// sortedRuntimes returns the runtimes of the mirror ordered by reference.
+func (m *mirror) sortedRuntimes() []mirrorRuntime {
+	runtimes := make([]mirrorRuntime, 0, len(m.runtimes))
+	for _, rt := range m.runtimes {
+		runtimes = append(runtimes, *rt)
+	}
+
+	sort.Slice(runtimes, func(i, j int) bool {
+		return runtimes[i].ref() < runtimes[j].ref()
+	})
+
+	return runtimes
+}
+
+// runtimeBlobs returns the descriptors of the runtime and of all the blobs it
+// references in the OCI image layout of the mirror.  Referenced blobs come
+// first, such that every blob can be saved after the ones it references.
+func (m *mirror) runtimeBlobs(rt mirrorRuntime) ([]ocispec.Descriptor, error) {
+	src := dirSource(m.runtimesLayout())
+
+	var index ocispec.Index
+	if err := readJSON(src, ocispec.ImageIndexFile, &index); err != nil {
+		return nil, err
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] != rt.ref() {
+			continue
+		}
+
+		blobs, err := layoutBlobs(src, desc)
+		if err != nil {
+			return nil, err
+		}
+
+		// Images for different platforms may share blobs.
+		seen := map[string]bool{}
+		unique := blobs[:0]
+		for _, blob := range blobs {
+			if !seen[blob.Digest.String()] {
+				seen[blob.Digest.String()] = true
+				unique = append(unique, blob)
+			}
+		}
+
+		return unique, nil
+	}
+
+	return nil, fmt.Errorf("%s is not in the OCI image layout of %s", rt.ref(), m.path)
+}
+
+// layoutBlobs returns the descriptors of the blobs referenced by desc,
+// followed by desc itself.
+func layoutBlobs(src imageSource, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	var blobs []ocispec.Descriptor
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, dockerManifestList:
+		var index ocispec.Index
+		if err := readBlob(src, desc.Digest, &index); err != nil {
+			return nil, err
+		}
+
+		for _, child := range index.Manifests {
+			more, err := layoutBlobs(src, child)
+			if err != nil {
+				return nil, err
+			}
+			blobs = append(blobs, more...)
+		}
+
+	case ocispec.MediaTypeImageManifest, dockerManifest:
+		var manifest ocispec.Manifest
+		if err := readBlob(src, desc.Digest, &manifest); err != nil {
+			return nil, err
+		}
+
+		blobs = append(blobs, manifest.Config)
+		blobs = append(blobs, manifest.Layers...)
+	}
+
+	return append(blobs, desc), nil
+}
@@ -0,0 +1,284 @@
+package unikraft
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMirror(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "mirror")
+
+	musl := filepath.Join(dir, "musl")
+	if err := os.MkdirAll(filepath.Join(musl, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(musl, "Makefile.uk"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(musl, ".git", "HEAD"), []byte("ref"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := openMirror(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stable, err := m.add(Component{Type: "lib", Name: "musl", Version: "stable", Source: "https://github.com/unikraft/lib-musl.git", Path: musl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the mirror adds to the existing manifests.
+	if m, err = openMirror(out); err != nil {
+		t.Fatal(err)
+	}
+	tagged, err := m.add(Component{Type: "lib", Name: "musl", Version: "v1.2.3", Path: musl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.add(Component{Type: "core", Name: "unikraft", Path: musl}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var index mirrorIndex
+	readYaml(t, filepath.Join(out, "index.yaml"), &index)
+
+	refs := []string{}
+	for _, entry := range index.Manifests {
+		refs = append(refs, entry.Type+"/"+entry.Name+" "+entry.Manifest)
+	}
+	want := []string{
+		"core/unikraft core/unikraft.yaml",
+		"lib/musl lib/musl.yaml",
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("expected manifests %v, got %v", want, refs)
+	}
+
+	var manifest mirrorManifest
+	readYaml(t, filepath.Join(out, "lib", "musl.yaml"), &manifest)
+
+	if manifest.Origin != "https://github.com/unikraft/lib-musl.git" {
+		t.Errorf("expected the origin to be kept, got %q", manifest.Origin)
+	}
+	if len(manifest.Channels) != 1 || manifest.Channels[0].Name != "stable" || !manifest.Channels[0].Default || manifest.Channels[0].Resource != "lib/musl/stable.tar.gz" {
+		t.Errorf("unexpected channels %+v", manifest.Channels)
+	}
+	if len(manifest.Versions) != 1 || manifest.Versions[0].Version != "v1.2.3" || manifest.Versions[0].Resource != "lib/musl/v1.2.3.tar.gz" {
+		t.Errorf("unexpected versions %+v", manifest.Versions)
+	}
+	if stable != filepath.Join(out, "lib", "musl", "stable.tar.gz") {
+		t.Errorf("expected the archive in the mirror, got %s", stable)
+	}
+
+	b, err := os.ReadFile(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	if manifest.Versions[0].Sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected checksum %x, got %s", sum, manifest.Versions[0].Sha256)
+	}
+
+	// Archiving the same sources again gives the same archive.
+	again, err := archiveSources(musl, filepath.Join(dir, "again.tar.gz"), "musl-v1.2.3")
+	if err != nil || again != manifest.Versions[0].Sha256 {
+		t.Errorf("expected reproducible archives, got %s (%v)", again, err)
+	}
+
+	f, err := os.Open(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := []string{"musl-v1.2.3/", "musl-v1.2.3/Makefile.uk"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected archive entries %v, got %v", want, names)
+	}
+}
+
+func TestMirror_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "mirror")
+
+	m, err := openMirror(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.add(Component{Type: "lib", Name: "musl", Version: "v1.2.3", Path: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mirror keeps working once moved.
+	moved := filepath.Join(dir, "moved")
+	if err := os.Rename(out, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err = openMirror(moved); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := t.TempDir()
+	index, err := m.resolve(resolved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != filepath.Join(resolved, "index.yaml") {
+		t.Errorf("expected the index in %s, got %s", resolved, index)
+	}
+
+	var idx mirrorIndex
+	readYaml(t, index, &idx)
+
+	if len(idx.Manifests) != 1 || idx.Manifests[0].Manifest != filepath.Join(resolved, "lib", "musl.yaml") {
+		t.Fatalf("unexpected manifests %+v", idx.Manifests)
+	}
+
+	var manifest mirrorManifest
+	readYaml(t, idx.Manifests[0].Manifest, &manifest)
+
+	resource := filepath.Join(moved, "lib", "musl", "v1.2.3.tar.gz")
+	if len(manifest.Versions) != 1 || manifest.Versions[0].Resource != resource {
+		t.Errorf("expected resource %s, got %+v", resource, manifest.Versions)
+	}
+	if _, err := os.Stat(resource); err != nil {
+		t.Error(err)
+	}
+
+	// The mirror itself is left relative.
+	readYaml(t, filepath.Join(moved, "lib", "musl.yaml"), &manifest)
+	if manifest.Versions[0].Resource != "lib/musl/v1.2.3.tar.gz" {
+		t.Errorf("expected a relative resource, got %s", manifest.Versions[0].Resource)
+	}
+}
+
+func TestMirror_Runtime(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "mirror")
+
+	m, err := openMirror(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := newMirrorRuntime("unikraft.org/base", "")
+	if err := m.addRuntime(base, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Vendoring the runtime again replaces it.
+	if m, err = openMirror(out); err != nil {
+		t.Fatal(err)
+	}
+	index, err := random.Index(64, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.addRuntime(base, index); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var idx mirrorIndex
+	readYaml(t, filepath.Join(out, "index.yaml"), &idx)
+
+	digest, _ := index.Digest()
+	want := []mirrorRuntime{{Name: "unikraft.org/base", Version: "latest", Digest: digest.String()}}
+	if !reflect.DeepEqual(idx.Runtimes, want) {
+		t.Fatalf("expected runtimes %+v, got %+v", want, idx.Runtimes)
+	}
+
+	if m, err = openMirror(out); err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := m.runtimeBlobs(m.sortedRuntimes()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two images of a manifest, a config and two layers each, and their index.
+	if len(blobs) != 9 {
+		t.Fatalf("expected 9 blobs, got %d", len(blobs))
+	}
+	if last := blobs[len(blobs)-1]; last.Digest.String() != digest.String() || last.MediaType != ocispec.MediaTypeImageIndex {
+		t.Errorf("expected the index last, got %+v", last)
+	}
+	for _, blob := range blobs {
+		if _, err := os.Stat(filepath.Join(out, mirrorRuntimesDir, filepath.FromSlash(imageBlob(blob.Digest)))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	oldDigest, _ := old.Digest()
+	if _, err := os.Stat(filepath.Join(out, mirrorRuntimesDir, "blobs", "sha256", oldDigest.Hex)); !os.IsNotExist(err) {
+		t.Errorf("expected the replaced runtime to be removed, got %v", err)
+	}
+
+	// KraftKit reads runtimes from its package store rather than the index.
+	resolved, err := m.resolve(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resolvedIdx mirrorIndex
+	readYaml(t, resolved, &resolvedIdx)
+	if len(resolvedIdx.Runtimes) != 0 {
+		t.Errorf("expected no runtimes in the resolved index, got %+v", resolvedIdx.Runtimes)
+	}
+}
+
+func readYaml(t *testing.T, path string, v interface{}) {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+}
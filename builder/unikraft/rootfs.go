@@ -0,0 +1,161 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// RootfsCompressions lists the compressions supported by every rootfs
+// format.
+var RootfsCompressions = map[string][]string{
+	RootfsFormatCpio:  {"gzip"},
+	RootfsFormatErofs: {"lz4", "lz4hc", "lzma"},
+	RootfsFormatExt4:  nil,
+}
+
+// checkRootfsFormat returns an error if the format is unknown or does not
+// support the compression.
+func checkRootfsFormat(format, compression string) error {
+	compressions, ok := RootfsCompressions[format]
+	if !ok {
+		return fmt.Errorf("invalid rootfs format %q, expected %s, %s or %s", format, RootfsFormatCpio, RootfsFormatErofs, RootfsFormatExt4)
+	}
+
+	if compression != "" && !slices.Contains(compressions, compression) {
+		if len(compressions) == 0 {
+			return fmt.Errorf("the %s rootfs format does not support compression", format)
+		}
+
+		return fmt.Errorf("invalid %s rootfs compression %q, expected one of %v", format, compression, compressions)
+	}
+
+	return nil
+}
+
+// workdirPath returns the path, relative to workdir unless it is absolute, as
+// paths of a Kraftfile are relative to the project rather than to the working
+// directory of Packer.
+func workdirPath(workdir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(workdir, path)
+}
+
+// buildRootfsImage writes a filesystem image of the given format holding the
+// files of the directory dir, relative to workdir, to output, using the
+// `mkfs` tool of the format.
+func buildRootfsImage(ctx context.Context, workdir, dir, output, format, compression string) error {
+	if err := checkRootfsFormat(format, compression); err != nil {
+		return err
+	}
+
+	dir = workdirPath(workdir, dir)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("the %s rootfs format requires the rootfs to be a directory, %s is not", format, dir)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(output); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var cmd *exec.Cmd
+
+	switch format {
+	case RootfsFormatErofs:
+		args := []string{"-T0"}
+		if compression != "" {
+			args = append(args, "-z"+compression)
+		}
+		cmd = exec.CommandContext(ctx, "mkfs.erofs", append(args, output, dir)...)
+
+	case RootfsFormatExt4:
+		size, inodes, err := ext4ImageSize(dir)
+		if err != nil {
+			return err
+		}
+
+		// The image is created upfront, as mkfs.ext4 only formats it.
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		if err := f.Truncate(size); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		cmd = exec.CommandContext(ctx, "mkfs.ext4", "-q", "-F", "-L", "rootfs",
+			"-N", fmt.Sprint(inodes), "-E", "root_owner=0:0", "-d", dir, output)
+
+	default:
+		return fmt.Errorf("cannot build a %s rootfs from a directory", format)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", cmd.Args[0], err, out)
+	}
+
+	return nil
+}
+
+// ext4ImageSize returns the size of an ext4 image able to hold the files of
+// dir, i.e. their size rounded up to blocks, a block for every other entry,
+// and headroom for the metadata and journal of the filesystem, together with
+// the number of inodes it needs.
+func ext4ImageSize(dir string) (int64, int, error) {
+	const (
+		block    = 4 << 10
+		headroom = 16 << 20
+		// Inodes reserved by ext4 and left for files added later on.
+		spareInodes = 1024
+	)
+
+	var size int64
+	inodes := spareInodes
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		inodes++
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			size += (info.Size() + block - 1) / block * block
+		} else {
+			size += block
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size = size*5/4 + headroom
+
+	// Round up to a multiple of 1 MiB.
+	return (size + 1<<20 - 1) &^ (1<<20 - 1), inodes, nil
+}
@@ -0,0 +1,150 @@
+package unikraft
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckRootfsFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		compression string
+		err         string
+	}{
+		{format: "cpio"},
+		{format: "cpio", compression: "gzip"},
+		{format: "erofs", compression: "lz4hc"},
+		{format: "ext4"},
+		{format: "squashfs", err: "invalid rootfs format"},
+		{format: "cpio", compression: "lz4", err: "invalid cpio rootfs compression"},
+		{format: "ext4", compression: "gzip", err: "does not support compression"},
+	}
+
+	for _, tt := range tests {
+		err := checkRootfsFormat(tt.format, tt.compression)
+		if tt.err == "" && err != nil {
+			t.Errorf("unexpected error for %s/%s: %s", tt.format, tt.compression, err)
+		} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("expected error containing %q for %s/%s, got %v", tt.err, tt.format, tt.compression, err)
+		}
+	}
+}
+
+func testRootfsDir(t *testing.T) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "rootfs")
+	if err := os.MkdirAll(filepath.Join(dir, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "etc", "app.conf"), []byte("listen 80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestBuildRootfsImage_Ext4(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 is not available")
+	}
+
+	output := filepath.Join(t.TempDir(), "build", "rootfs-x86_64.ext4")
+	if err := buildRootfsImage(context.Background(), "", testRootfsDir(t), output, RootfsFormatExt4, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The magic number of the superblock, at 1024 + 0x38.
+	if len(b) < 1082 || b[1080] != 0x53 || b[1081] != 0xef {
+		t.Fatal("expected an ext4 image")
+	}
+
+	if _, err := exec.LookPath("debugfs"); err != nil {
+		return
+	}
+
+	out, err := exec.Command("debugfs", "-R", "cat /etc/app.conf", output).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "listen 80" {
+		t.Errorf("expected the image to hold etc/app.conf, got %q", out)
+	}
+}
+
+func TestBuildRootfsImage_Workdir(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 is not available")
+	}
+
+	workdir := filepath.Dir(testRootfsDir(t))
+
+	// The rootfs of the Kraftfile is relative to the project, not to the
+	// working directory of Packer.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	output := filepath.Join(workdir, "rootfs-x86_64.ext4")
+	if err := buildRootfsImage(context.Background(), workdir, "rootfs", output, RootfsFormatExt4, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(output); err != nil {
+		t.Error(err)
+	}
+
+	if got, want := workdirPath(workdir, "rootfs"), filepath.Join(workdir, "rootfs"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if got := workdirPath(workdir, "/rootfs"); got != "/rootfs" {
+		t.Errorf("expected absolute paths to be kept, got %s", got)
+	}
+}
+
+func TestBuildRootfsImage_Erofs(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.erofs"); err != nil {
+		t.Skip("mkfs.erofs is not available")
+	}
+
+	output := filepath.Join(t.TempDir(), "rootfs-x86_64.erofs")
+	if err := buildRootfsImage(context.Background(), "", testRootfsDir(t), output, RootfsFormatErofs, "lz4"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The magic number of the superblock, at 1024.
+	if len(b) < 1028 || string(b[1024:1028]) != "\xe2\xe1\xf5\xe0" {
+		t.Fatal("expected an erofs image")
+	}
+}
+
+func TestBuildRootfsImage_NotDirectory(t *testing.T) {
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(dockerfile, []byte("FROM scratch"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := buildRootfsImage(context.Background(), "", dockerfile, filepath.Join(t.TempDir(), "rootfs.ext4"), RootfsFormatExt4, "")
+	if err == nil || !strings.Contains(err.Error(), "requires the rootfs to be a directory") {
+		t.Errorf("expected an error for a rootfs which is not a directory, got %v", err)
+	}
+}
@@ -2,9 +2,14 @@ package unikraft
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -16,7 +21,7 @@ type StepBuild struct {
 }
 
 // Run should execute the purpose of this step
-func (s *StepBuild) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepBuild) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config, ok := state.Get("config").(*Config)
 	if !ok {
@@ -28,7 +33,50 @@ func (s *StepBuild) Run(_ context.Context, state multistep.StateBag) multistep.S
 
 	driver := state.Get("driver").(Driver)
 
-	err := driver.Build(config.Path, config.Architecture, config.Platform, config.Target)
+	env := make([]string, 0, len(config.Env))
+	for k, v := range config.Env {
+		// An empty value is taken from the environment of the host.
+		if v == "" {
+			env = append(env, k)
+		} else {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	sort.Strings(env)
+
+	// The rootfs provisioners operate on is archived into the initramfs when
+	// it was asked for or provisioned.  Otherwise the rootfs of the Kraftfile,
+	// e.g. a Dockerfile, is kept.
+	var rootfs string
+	comm, _ := state.Get("communicator").(*RootfsCommunicator)
+	if _, err := os.Stat(config.Rootfs); config.Rootfs != "" && err == nil &&
+		(config.rootfsSet || config.RootfsImage != "" || (comm != nil && comm.provisioned)) {
+		rootfs = config.Rootfs
+		ui.Say(fmt.Sprintf("Using rootfs %s instead of the rootfs of the Kraftfile", rootfs))
+	}
+
+	results, err := driver.Build(ctx, BuildOptions{
+		Path:         config.Path,
+		Architecture: config.Architecture,
+		Platform:     config.Platform,
+		Target:       config.Target,
+		All:          config.AllTargets,
+		Parallel:     config.ParallelTargets,
+		KeepGoing:    config.KeepGoing,
+		Jobs:         config.Jobs,
+		KernelDbg:    config.KernelDbg,
+		DotConfig:    config.DotConfig,
+		Kraftfile:    config.Kraftfile,
+		NoConfigure:  config.NoConfigure,
+		NoFetch:      config.NoFetch,
+		ForcePull:    config.ForcePull,
+		Rootfs:       rootfs,
+		SaveBuildLog: config.SaveBuildLog,
+		Env:          env,
+
+		RootfsFormat:      config.RootfsFormat,
+		RootfsCompression: config.RootfsCompression,
+	})
 	if err != nil {
 		err := fmt.Errorf("error encountered building kraft package: %s", err)
 		state.Put("error", err)
@@ -36,14 +84,21 @@ func (s *StepBuild) Run(_ context.Context, state multistep.StateBag) multistep.S
 		return multistep.ActionHalt
 	}
 
+	buildDir := filepath.Join(config.Path, ".unikraft", "build")
+	distDir := filepath.Join(config.Path, ".unikraft", "dist")
+
 	// Copy all executable files in the `path/build` folder and move them to `path/dist`
 	// Open the folder for reading
 	var executableFiles []string = []string{}
-	filepath.Walk(filepath.Join(config.Path, ".unikraft", "build"), func(path string, info os.FileInfo, err error) error {
+	filepath.Walk(buildDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
 		// Check if the file is executable and not a symlink or directory
 		if !info.IsDir() && info.Mode()&0111 != 0 && info.Mode()&os.ModeSymlink == 0 {
 			// Check if the file is in the root of the build folder
-			if !strings.ContainsRune(strings.TrimPrefix(path, filepath.Join(config.Path, ".unikraft", "build"))[1:], filepath.Separator) {
+			if !strings.ContainsRune(strings.TrimPrefix(path, buildDir)[1:], filepath.Separator) {
 				executableFiles = append(executableFiles, path)
 			}
 		}
@@ -51,26 +106,127 @@ func (s *StepBuild) Run(_ context.Context, state multistep.StateBag) multistep.S
 		return nil
 	})
 
+	// Targets built in parallel place their kernels in a dedicated build
+	// folder, so also keep these together with their debug images and the
+	// initramfs they were built with.
+	for _, result := range results {
+		for _, file := range []string{result.Kernel, result.KernelDbg, result.Initramfs} {
+			if file == "" {
+				continue
+			}
+
+			file = filepath.Clean(file)
+			if !strings.HasPrefix(file, buildDir+string(filepath.Separator)) || slices.Contains(executableFiles, file) {
+				continue
+			}
+
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+
+			executableFiles = append(executableFiles, file)
+		}
+	}
+
 	// Create the dist folder if it doesn't exist
-	if _, err := os.Stat(filepath.Join(config.Path, ".unikraft", "dist")); os.IsNotExist(err) {
-		os.Mkdir(filepath.Join(config.Path, ".unikraft", "dist"), 0755)
+	if _, err := os.Stat(distDir); os.IsNotExist(err) {
+		os.Mkdir(distDir, 0755)
 	}
 
-	// Move the files to the dist folder
+	// Move the files to the dist folder, keeping their location relative to the
+	// build folder such that they are found at their original path once the
+	// dist folder is renamed back during cleanup.
+	moved := map[string]string{}
 	for _, file := range executableFiles {
-		ui.Say(fmt.Sprintf("Moving %s to %s", file, filepath.Join(config.Path, ".unikraft", "dist", filepath.Base(file))))
-		err := os.Rename(file, filepath.Join(config.Path, ".unikraft", "dist", filepath.Base(file)))
+		rel, err := filepath.Rel(buildDir, file)
 		if err != nil {
+			rel = filepath.Base(file)
+		}
+
+		dest := filepath.Join(distDir, rel)
+		ui.Say(fmt.Sprintf("Moving %s to %s", file, dest))
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
 			err := fmt.Errorf("error encountered saving kraft package: %s", err)
 			state.Put("error", err)
 			ui.Error(err.Error())
 			return multistep.ActionHalt
 		}
+
+		err = os.Rename(file, dest)
+		if err != nil {
+			err := fmt.Errorf("error encountered saving kraft package: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		moved[filepath.Clean(file)] = dest
 	}
 
 	s.resultingBinariesPath = executableFiles
 	state.Put("binaries", s.resultingBinariesPath)
 
+	// Group the resulting kernels by platform and architecture, such that
+	// multi-target builds can be told apart by post-processors.
+	kernels := map[string][]string{}
+	for _, result := range results {
+		for _, file := range executableFiles {
+			if filepath.Clean(file) != filepath.Clean(result.Kernel) {
+				continue
+			}
+
+			platArch := fmt.Sprintf("%s/%s", result.Platform, result.Architecture)
+			kernels[platArch] = append(kernels[platArch], file)
+		}
+	}
+	state.Put("kernels", kernels)
+
+	entries := make([]ArtifactEntry, 0, len(results))
+	for _, result := range results {
+		entry := ArtifactEntry{
+			Kernel:       result.Kernel,
+			Architecture: result.Architecture,
+			Platform:     result.Platform,
+			Target:       result.Target,
+			Version:      result.Version,
+			Components:   result.Components,
+		}
+
+		// The files are only available in the dist folder until cleanup.
+		kernel := result.Kernel
+		if dest, ok := moved[filepath.Clean(kernel)]; ok {
+			kernel = dest
+		}
+
+		digest, err := sha256File(kernel)
+		if err != nil {
+			err := fmt.Errorf("error encountered computing kernel digest: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		entry.Sha256 = digest
+
+		if _, ok := moved[filepath.Clean(result.KernelDbg)]; ok {
+			entry.KernelDbg = result.KernelDbg
+		}
+
+		if result.Initramfs != "" {
+			if _, err := os.Stat(result.Initramfs); err == nil {
+				entry.Initramfs = result.Initramfs
+			} else if _, ok := moved[filepath.Clean(result.Initramfs)]; ok {
+				entry.Initramfs = result.Initramfs
+			}
+		}
+		if entry.Initramfs != "" {
+			entry.RootfsFormat = result.RootfsFormat
+		}
+
+		entries = append(entries, entry)
+	}
+	state.Put("entries", entries)
+
 	return multistep.ActionContinue
 }
 
@@ -102,3 +258,19 @@ func (s *StepBuild) Cleanup(state multistep.StateBag) {
 		ui.Error(err.Error())
 	}
 }
+
+// sha256File returns the hex encoded SHA-256 digest of the given file.
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,253 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		results  func(buildDir string) []BuildResult
+		files    map[string]os.FileMode
+		action   multistep.StepAction
+		binaries []string
+		kernels  map[string][]string
+		kept     []string
+		sha256   string
+	}{
+		{
+			name:   "build error",
+			err:    errors.New("boom"),
+			files:  map[string]os.FileMode{"helloworld_qemu-x86_64": 0755},
+			action: multistep.ActionHalt,
+		},
+		{
+			name: "single target",
+			results: func(buildDir string) []BuildResult {
+				return []BuildResult{{
+					Target:       "helloworld-qemu-x86_64",
+					Architecture: "x86_64",
+					Platform:     "qemu",
+					Kernel:       filepath.Join(buildDir, "helloworld_qemu-x86_64"),
+					Components: []Component{
+						{Type: "core", Name: "unikraft", Version: "stable"},
+					},
+				}}
+			},
+			files: map[string]os.FileMode{
+				"helloworld_qemu-x86_64": 0755,
+				"config":                 0644,
+				"libs/lib.o":             0755,
+			},
+			action:   multistep.ActionContinue,
+			binaries: []string{"helloworld_qemu-x86_64"},
+			kernels:  map[string][]string{"qemu/x86_64": {"helloworld_qemu-x86_64"}},
+			kept:     []string{"helloworld_qemu-x86_64"},
+			sha256:   "fd9379542b75341166e034aff4b760470a18a7fda3ea2c957ef0becb8914433a",
+		},
+		{
+			name: "parallel targets",
+			results: func(buildDir string) []BuildResult {
+				return []BuildResult{{
+					Target:       "helloworld-fc-x86_64",
+					Architecture: "x86_64",
+					Platform:     "fc",
+					Kernel:       filepath.Join(buildDir, "helloworld-fc-x86_64", "helloworld_fc-x86_64"),
+					KernelDbg:    filepath.Join(buildDir, "helloworld-fc-x86_64", "helloworld_fc-x86_64.dbg"),
+				}}
+			},
+			files: map[string]os.FileMode{
+				"helloworld-fc-x86_64/helloworld_fc-x86_64":     0755,
+				"helloworld-fc-x86_64/helloworld_fc-x86_64.dbg": 0755,
+				"helloworld-fc-x86_64/config":                   0644,
+			},
+			action: multistep.ActionContinue,
+			binaries: []string{
+				"helloworld-fc-x86_64/helloworld_fc-x86_64",
+				"helloworld-fc-x86_64/helloworld_fc-x86_64.dbg",
+			},
+			kernels: map[string][]string{"fc/x86_64": {"helloworld-fc-x86_64/helloworld_fc-x86_64"}},
+			kept: []string{
+				"helloworld-fc-x86_64/helloworld_fc-x86_64",
+				"helloworld-fc-x86_64/helloworld_fc-x86_64.dbg",
+			},
+			sha256: "ea5bd01497449659429751ae7a294f209529f3278a0796eb6779955966dd0db8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			buildDir := filepath.Join(path, ".unikraft", "build")
+			for name, mode := range tt.files {
+				file := filepath.Join(buildDir, name)
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(file, []byte(name), mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			driver := &MockDriver{BuildErr: tt.err}
+			if tt.results != nil {
+				driver.BuildResults = tt.results(buildDir)
+			}
+
+			config := &Config{
+				Path:         path,
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				Env:          map[string]string{"B": "2", "A": ""},
+			}
+			state := testState(t, config, driver)
+			step := &StepBuild{}
+
+			action := step.Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			if driver.CallCount("Build") != 1 {
+				t.Fatalf("expected a single Build call, got %d", driver.CallCount("Build"))
+			}
+			opts := lastBuildOptions(t, driver)
+			if opts.Path != path || opts.Architecture != "x86_64" || opts.Platform != "qemu" {
+				t.Errorf("unexpected Build options %+v", opts)
+			}
+			if env := []string{"A", "B=2"}; !reflect.DeepEqual(opts.Env, env) {
+				t.Errorf("expected env %v, got %v", env, opts.Env)
+			}
+
+			if tt.action == multistep.ActionHalt {
+				if _, ok := state.GetOk("binaries"); ok {
+					t.Error("expected no binaries in the state")
+				}
+				return
+			}
+
+			var binaries []string
+			for _, name := range tt.binaries {
+				binaries = append(binaries, filepath.Join(buildDir, name))
+			}
+			if got := state.Get("binaries").([]string); !reflect.DeepEqual(got, binaries) {
+				t.Errorf("expected binaries %v, got %v", binaries, got)
+			}
+
+			kernels := map[string][]string{}
+			for platArch, names := range tt.kernels {
+				for _, name := range names {
+					kernels[platArch] = append(kernels[platArch], filepath.Join(buildDir, name))
+				}
+			}
+			if got := state.Get("kernels").(map[string][]string); !reflect.DeepEqual(got, kernels) {
+				t.Errorf("expected kernels %v, got %v", kernels, got)
+			}
+
+			entries := state.Get("entries").([]ArtifactEntry)
+			if len(entries) != 1 {
+				t.Fatalf("expected a single entry, got %v", entries)
+			}
+			if entries[0].Kernel != driver.BuildResults[0].Kernel {
+				t.Errorf("expected entry for %s, got %s", driver.BuildResults[0].Kernel, entries[0].Kernel)
+			}
+			if entries[0].Sha256 != tt.sha256 {
+				t.Errorf("expected digest %s, got %s", tt.sha256, entries[0].Sha256)
+			}
+			if !reflect.DeepEqual(entries[0].Components, driver.BuildResults[0].Components) {
+				t.Errorf("expected components %v, got %v", driver.BuildResults[0].Components, entries[0].Components)
+			}
+
+			step.Cleanup(state)
+
+			if _, ok := state.GetOk("error"); ok {
+				t.Fatalf("unexpected error during cleanup: %s", state.Get("error"))
+			}
+
+			var kept []string
+			err := filepath.Walk(buildDir, func(file string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(buildDir, file)
+				kept = append(kept, rel)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("expected %v to be kept, got %v", tt.kept, kept)
+			}
+		})
+	}
+}
+
+func TestStepBuild_Rootfs(t *testing.T) {
+	tests := []struct {
+		name        string
+		exists      bool
+		set         bool
+		image       bool
+		provisioned bool
+		override    bool
+	}{
+		{name: "default", exists: true},
+		{name: "provisioned", exists: true, provisioned: true, override: true},
+		{name: "set", exists: true, set: true, override: true},
+		{name: "rootfs image", exists: true, image: true, override: true},
+		{name: "missing", set: true, provisioned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			rootfs := filepath.Join(path, "rootfs")
+			if tt.exists {
+				if err := os.Mkdir(rootfs, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			driver := &MockDriver{BuildErr: errors.New("boom")}
+			config := &Config{Path: path, Rootfs: rootfs, RootfsFormat: "erofs", RootfsCompression: "lz4", rootfsSet: tt.set}
+			if tt.image {
+				config.RootfsImage = filepath.Join(path, "image.tar")
+			}
+			state := testState(t, config, driver)
+			state.Put("communicator", &RootfsCommunicator{Path: rootfs, provisioned: tt.provisioned})
+
+			(&StepBuild{}).Run(context.Background(), state)
+
+			want := ""
+			if tt.override {
+				want = rootfs
+			}
+			opts := lastBuildOptions(t, driver)
+			if opts.Rootfs != want {
+				t.Errorf("expected rootfs %q, got %q", want, opts.Rootfs)
+			}
+			if opts.RootfsFormat != "erofs" || opts.RootfsCompression != "lz4" {
+				t.Errorf("unexpected rootfs format %+v", opts)
+			}
+		})
+	}
+}
+
+// lastBuildOptions returns the options of the last Build call of the driver.
+func lastBuildOptions(t *testing.T, driver *MockDriver) BuildOptions {
+	t.Helper()
+
+	args := driver.LastArgs("Build")
+	if len(args) != 1 {
+		t.Fatal("expected Build to be called")
+	}
+
+	return args[0].(BuildOptions)
+}
@@ -0,0 +1,35 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type StepRootfsCommunicator struct {
+}
+
+// Run sets up the communicator of the provisioners, which operates on the
+// rootfs of the project.
+func (s *StepRootfsCommunicator) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("communicator", &RootfsCommunicator{
+		Path:   config.Rootfs,
+		Chroot: config.RootfsChroot,
+	})
+
+	return multistep.ActionContinue
+}
+
+// Cleanup keeps the rootfs, as it is archived into the initramfs.
+func (s *StepRootfsCommunicator) Cleanup(_ multistep.StateBag) {}
@@ -0,0 +1,129 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type StepLockfilePin struct {
+}
+
+// Run pins the components to the versions in the lockfile, if it exists, for
+// all subsequent pulls and builds.  This step is skipped if no lockfile is
+// specified.
+func (s *StepLockfilePin) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if config.Lockfile == "" {
+		return multistep.ActionContinue
+	}
+
+	lock, err := readLockfile(config.Lockfile)
+	if errors.Is(err, os.ErrNotExist) {
+		ui.Say(fmt.Sprintf("No lockfile found, writing %s after the build", config.Lockfile))
+		return multistep.ActionContinue
+	} else if err != nil {
+		err := fmt.Errorf("error encountered reading lockfile: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	driver := state.Get("driver").(Driver)
+
+	if err := driver.Pin(lock.pins()); err != nil {
+		err := fmt.Errorf("error encountered pinning components: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("lockfile", lock)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup does nothing, as the pins only live in the driver.
+func (s *StepLockfilePin) Cleanup(_ multistep.StateBag) {}
+
+type StepLockfileCheck struct {
+}
+
+// Run pulls the components of the project and checks that they match the
+// lockfile pinned by StepLockfilePin before anything is built, or writes the
+// lockfile if there was none.  This step is skipped if no lockfile is
+// specified.
+func (s *StepLockfileCheck) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if config.Lockfile == "" {
+		return multistep.ActionContinue
+	}
+
+	driver := state.Get("driver").(Driver)
+
+	components, err := driver.Resolve(ctx, ResolveOptions{
+		Path:         config.Path,
+		Kraftfile:    config.Kraftfile,
+		Architecture: config.Architecture,
+		Platform:     config.Platform,
+	})
+	if err != nil {
+		err := fmt.Errorf("error encountered pulling components: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	resolved, err := newLockfile(components)
+	if err != nil {
+		err := fmt.Errorf("error encountered resolving components: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if lock, ok := state.Get("lockfile").(*Lockfile); ok {
+		if err := lock.drift(resolved); err != nil {
+			err := fmt.Errorf("error encountered checking %s: %s", config.Lockfile, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		return multistep.ActionContinue
+	}
+
+	if err := resolved.write(config.Lockfile); err != nil {
+		err := fmt.Errorf("error encountered writing lockfile: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Lockfile written to %s", config.Lockfile))
+
+	return multistep.ActionContinue
+}
+
+// Cleanup keeps the lockfile, as it is meant to be committed with the project.
+func (s *StepLockfileCheck) Cleanup(_ multistep.StateBag) {}
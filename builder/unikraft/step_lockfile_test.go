@@ -0,0 +1,199 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// runLockfileSteps runs the lockfile steps around a pull resolving the given
+// components, as Builder.Run does.
+func runLockfileSteps(t *testing.T, lockfile string, driver *MockDriver, components []Component) multistep.StateBag {
+	t.Helper()
+
+	state := testState(t, &Config{Lockfile: lockfile}, driver)
+
+	action := (&StepLockfilePin{}).Run(context.Background(), state)
+	if action != multistep.ActionContinue {
+		return state
+	}
+
+	driver.ResolveComponents = append(append([]Component{}, components...), components...)
+	(&StepLockfileCheck{}).Run(context.Background(), state)
+
+	return state
+}
+
+func TestStepLockfile(t *testing.T) {
+	dir := t.TempDir()
+
+	musl := filepath.Join(dir, "libs", "musl")
+	if err := os.MkdirAll(musl, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(musl, "Makefile.uk"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	components := []Component{
+		{Type: "lib", Name: "musl", Version: "stable", Source: "https://github.com/unikraft/lib-musl.git", Path: musl},
+		{Type: "core", Name: "unikraft", Version: "v0.16.1"},
+	}
+	lockfile := filepath.Join(dir, "kraft.lock.json")
+
+	// The first build writes the lockfile without pinning anything.
+	driver := &MockDriver{}
+	state := runLockfileSteps(t, lockfile, driver, components)
+	assertAction(t, state, multistep.ActionContinue, multistep.ActionContinue)
+	if driver.CallCount("Pin") != 0 {
+		t.Error("expected no components to be pinned without a lockfile")
+	}
+
+	lock, err := readLockfile(lockfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Components) != 2 || lock.Components[0].Name != "unikraft" || lock.Components[1].Digest == "" {
+		t.Errorf("unexpected lockfile %+v", lock)
+	}
+
+	// Later builds are pinned to the lockfile.
+	driver = &MockDriver{}
+	state = runLockfileSteps(t, lockfile, driver, components)
+	assertAction(t, state, multistep.ActionContinue, multistep.ActionContinue)
+
+	pins := []Component{
+		{Type: "core", Name: "unikraft", Version: "v0.16.1"},
+		{Type: "lib", Name: "musl", Version: "stable", Source: "https://github.com/unikraft/lib-musl.git"},
+	}
+	if args := driver.LastArgs("Pin"); len(args) != 1 || !reflect.DeepEqual(args[0], pins) {
+		t.Errorf("expected pins %+v, got %+v", pins, args)
+	}
+
+	tests := []struct {
+		name       string
+		components func() []Component
+		err        string
+	}{
+		{
+			name: "changed sources",
+			components: func() []Component {
+				if err := os.WriteFile(filepath.Join(musl, "Makefile.uk"), []byte("v2"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return components
+			},
+			err: "lib/musl has digest",
+		},
+		{
+			name: "changed version",
+			components: func() []Component {
+				return []Component{components[0], {Type: "core", Name: "unikraft", Version: "v0.17.0"}}
+			},
+			err: "core/unikraft has version v0.17.0, locked v0.16.1",
+		},
+		{
+			name: "new component",
+			components: func() []Component {
+				return append(components[:2:2], Component{Type: "lib", Name: "lwip", Version: "stable"})
+			},
+			err: "lib/lwip is not locked",
+		},
+		{
+			name: "removed component",
+			components: func() []Component {
+				return components[1:]
+			},
+			err: "lib/musl is locked but no longer used",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := runLockfileSteps(t, lockfile, &MockDriver{}, tt.components())
+
+			err, ok := state.GetOk("error")
+			if !ok || !strings.Contains(err.(error).Error(), tt.err) {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	t.Run("invalid lockfile", func(t *testing.T) {
+		invalid := filepath.Join(dir, "invalid.json")
+		if err := os.WriteFile(invalid, []byte(`{"version": 99}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		state := testState(t, &Config{Lockfile: invalid}, &MockDriver{})
+		action := (&StepLockfilePin{}).Run(context.Background(), state)
+		assertAction(t, state, action, multistep.ActionHalt)
+	})
+
+	t.Run("resolve error", func(t *testing.T) {
+		state := runLockfileSteps(t, lockfile, &MockDriver{ResolveErr: errors.New("boom")}, components)
+		if _, ok := state.GetOk("error"); !ok {
+			t.Error("expected an error when the components cannot be pulled")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		driver := &MockDriver{}
+		state := runLockfileSteps(t, "", driver, components)
+		assertAction(t, state, multistep.ActionContinue, multistep.ActionContinue)
+		if len(driver.Calls) != 0 {
+			t.Errorf("expected no driver calls, got %+v", driver.Calls)
+		}
+	})
+}
+
+func TestResolvedVersion(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Makefile.uk"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sources without a repository keep the requested version.
+	if got := resolvedVersion(context.Background(), dir, "stable"); got != "stable" {
+		t.Errorf("expected stable, got %s", got)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "v1"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := resolvedVersion(context.Background(), dir, "stable"), strings.TrimSpace(string(out)); got != want {
+		t.Errorf("expected commit %s, got %s", want, got)
+	}
+
+	// Directories within the repository are not resolved to its commit.
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolvedVersion(context.Background(), sub, "stable"); got != "stable" {
+		t.Errorf("expected stable, got %s", got)
+	}
+}
@@ -15,7 +15,7 @@ type StepPkgPull struct {
 }
 
 // Run calls `kraft pkg pull` with the given repository to pull it locally.
-func (s *StepPkgPull) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepPkgPull) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config, ok := state.Get("config").(*Config)
 	if !ok {
@@ -31,7 +31,7 @@ func (s *StepPkgPull) Run(_ context.Context, state multistep.StateBag) multistep
 
 	driver := state.Get("driver").(Driver)
 
-	err := driver.Pull(config.PullSource, config.Workdir)
+	err := driver.Pull(ctx, config.PullSource, config.Workdir)
 	if err != nil {
 		err := fmt.Errorf("error encountered pulling kraft package: %s", err)
 		state.Put("error", err)
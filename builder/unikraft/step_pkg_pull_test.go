@@ -0,0 +1,85 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepPkgPull(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		driver *MockDriver
+		action multistep.StepAction
+		pulled bool
+	}{
+		{
+			name:   "no source",
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+		},
+		{
+			name:   "pull",
+			source: "app-helloworld",
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+			pulled: true,
+		},
+		{
+			name:   "pull error",
+			source: "app-helloworld",
+			driver: &MockDriver{PullErr: errors.New("boom")},
+			action: multistep.ActionHalt,
+			pulled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workdir := t.TempDir()
+			appDir := filepath.Join(workdir, ".unikraft", "apps", "helloworld")
+			unikraftDir := filepath.Join(appDir, ".unikraft", "unikraft")
+			libsDir := filepath.Join(appDir, ".unikraft", "libs")
+			buildDir := filepath.Join(appDir, ".unikraft", "build")
+			for _, dir := range []string{unikraftDir, libsDir, buildDir} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config := &Config{PullSource: tt.source, Workdir: workdir}
+			state := testState(t, config, tt.driver)
+			step := &StepPkgPull{}
+
+			action := step.Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			if pulled := tt.driver.CallCount("Pull") > 0; pulled != tt.pulled {
+				t.Fatalf("expected Pull called to be %t", tt.pulled)
+			}
+			if args := tt.driver.LastArgs("Pull"); tt.pulled && (args[0] != tt.source || args[1] != workdir) {
+				t.Errorf("unexpected Pull arguments %v", args)
+			}
+
+			step.Cleanup(state)
+
+			// Only the pulled sources are removed, the build output is kept.
+			for _, dir := range []string{unikraftDir, libsDir} {
+				_, err := os.Stat(dir)
+				if tt.source != "" && !os.IsNotExist(err) {
+					t.Errorf("expected %s to be removed", dir)
+				} else if tt.source == "" && err != nil {
+					t.Errorf("expected %s to be kept: %s", dir, err)
+				}
+			}
+			if _, err := os.Stat(buildDir); err != nil {
+				t.Errorf("expected %s to be kept: %s", buildDir, err)
+			}
+		})
+	}
+}
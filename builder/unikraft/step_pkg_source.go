@@ -8,13 +8,18 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
+// DefaultManifest is the manifest index sourced by KraftKit by default.
+const DefaultManifest = "https://manifests.kraftkit.sh/index.yaml"
+
 type StepPkgSource struct {
-	defaultAlreadyMissing bool
 }
 
 // Run executes the step of sourcing a package by calling the `kraft pkg source` command.
 // This step is skipped if no source is specified.
-func (s *StepPkgSource) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+//
+// Sources are only added to the per-build KraftKit configuration and are never
+// persisted to the user's configuration file.
+func (s *StepPkgSource) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config, ok := state.Get("config").(*Config)
 	if !ok {
@@ -27,11 +32,9 @@ func (s *StepPkgSource) Run(_ context.Context, state multistep.StateBag) multist
 	driver := state.Get("driver").(Driver)
 
 	if config.SourcesNoDefault {
-		s.defaultAlreadyMissing = false
-		err := driver.Unsource("https://manifests.kraftkit.sh/index.yaml")
+		err := driver.Unsource(ctx, DefaultManifest)
 		if err != nil {
 			// Do not fail if there's no default manifest, but output the error
-			s.defaultAlreadyMissing = true
 			err := fmt.Errorf("no default package link to unsource, continuing: %s", err)
 			ui.Error(err.Error())
 		}
@@ -42,7 +45,7 @@ func (s *StepPkgSource) Run(_ context.Context, state multistep.StateBag) multist
 	}
 
 	for _, source := range config.Sources {
-		err := driver.Source(source)
+		err := driver.Source(ctx, source)
 		if err != nil {
 			err := fmt.Errorf("error encountered sourcing kraft package: %s", err)
 			state.Put("error", err)
@@ -54,39 +57,6 @@ func (s *StepPkgSource) Run(_ context.Context, state multistep.StateBag) multist
 	return multistep.ActionContinue
 }
 
-// Cleanup is called after the step is finished and calls `kraft pkg unsource` to remove the source.
-func (s *StepPkgSource) Cleanup(state multistep.StateBag) {
-	ui := state.Get("ui").(packersdk.Ui)
-	config, ok := state.Get("config").(*Config)
-	if !ok {
-		err := fmt.Errorf("error encountered obtaining kraft config")
-		state.Put("error", err)
-		ui.Error(err.Error())
-		return
-	}
-
-	driver := state.Get("driver").(Driver)
-
-	if config.SourcesNoDefault || s.defaultAlreadyMissing {
-		err := driver.Source("https://manifests.kraftkit.sh/index.yaml")
-		if err != nil {
-			// Do not fail if there's no default manifest, but output the error
-			err := fmt.Errorf("could not resource default manifest, continuing: %s", err)
-			ui.Error(err.Error())
-		}
-	}
-
-	if len(config.Sources) == 0 {
-		return
-	}
-
-	for _, source := range config.Sources {
-		err := driver.Unsource(source)
-		if err != nil {
-			err := fmt.Errorf("error encountered unsourcing kraft package: %s", err)
-			state.Put("error", err)
-			ui.Error(err.Error())
-			return
-		}
-	}
-}
+// Cleanup does nothing, as the sources only live in the per-build
+// configuration which is discarded together with the driver.
+func (s *StepPkgSource) Cleanup(_ multistep.StateBag) {}
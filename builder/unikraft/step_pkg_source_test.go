@@ -0,0 +1,95 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepPkgSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		driver  *MockDriver
+		action  multistep.StepAction
+		sources []string
+		unsrc   bool
+	}{
+		{
+			name:   "missing config",
+			config: nil,
+			driver: &MockDriver{},
+			action: multistep.ActionHalt,
+		},
+		{
+			name:   "no sources",
+			config: &Config{},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+		},
+		{
+			name:    "sources",
+			config:  &Config{Sources: []string{"a", "b"}},
+			driver:  &MockDriver{},
+			action:  multistep.ActionContinue,
+			sources: []string{"a", "b"},
+		},
+		{
+			name:    "source error",
+			config:  &Config{Sources: []string{"a", "b"}},
+			driver:  &MockDriver{SourceErr: errors.New("boom")},
+			action:  multistep.ActionHalt,
+			sources: []string{"a"},
+		},
+		{
+			name:   "no default",
+			config: &Config{SourcesNoDefault: true},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+			unsrc:  true,
+		},
+		{
+			name:   "no default unsource error",
+			config: &Config{SourcesNoDefault: true},
+			driver: &MockDriver{UnsourceErr: errors.New("boom")},
+			action: multistep.ActionContinue,
+			unsrc:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := testState(t, tt.config, tt.driver)
+			step := &StepPkgSource{}
+
+			action := step.Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			var sources []string
+			for _, call := range tt.driver.Calls {
+				if call.Method == "Source" {
+					sources = append(sources, call.Args[0].(string))
+				}
+			}
+			if !reflect.DeepEqual(sources, tt.sources) {
+				t.Errorf("expected sources %v, got %v", tt.sources, sources)
+			}
+
+			if unsrc := tt.driver.CallCount("Unsource") > 0; unsrc != tt.unsrc {
+				t.Errorf("expected Unsource called to be %t", tt.unsrc)
+			}
+			if args := tt.driver.LastArgs("Unsource"); tt.unsrc && args[0] != DefaultManifest {
+				t.Errorf("expected %s to be unsourced, got %v", DefaultManifest, args[0])
+			}
+
+			calls := len(tt.driver.Calls)
+			step.Cleanup(state)
+			if len(tt.driver.Calls) != calls {
+				t.Errorf("expected no driver calls during cleanup")
+			}
+		})
+	}
+}
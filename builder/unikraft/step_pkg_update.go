@@ -12,10 +12,10 @@ type StepPkgUpdate struct {
 }
 
 // Run executes the step of updating the sources for a package by calling the `kraft pkg update` command.
-// This step will not do anything if no source is specified.
-func (s *StepPkgUpdate) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+// This step is skipped in offline mode.
+func (s *StepPkgUpdate) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
-	_, ok := state.Get("config").(*Config)
+	config, ok := state.Get("config").(*Config)
 	if !ok {
 		err := fmt.Errorf("error encountered obtaining kraft config")
 		state.Put("error", err)
@@ -23,9 +23,14 @@ func (s *StepPkgUpdate) Run(_ context.Context, state multistep.StateBag) multist
 		return multistep.ActionHalt
 	}
 
+	if config.Offline {
+		ui.Say("Offline, using the manifests available locally")
+		return multistep.ActionContinue
+	}
+
 	driver := state.Get("driver").(Driver)
 
-	err := driver.Update()
+	err := driver.Update(ctx)
 	if err != nil {
 		err := fmt.Errorf("error encountered updating kraft references: %s", err)
 		state.Put("error", err)
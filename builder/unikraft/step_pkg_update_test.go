@@ -0,0 +1,65 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepPkgUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		driver *MockDriver
+		action multistep.StepAction
+		calls  int
+	}{
+		{
+			name:   "missing config",
+			config: nil,
+			driver: &MockDriver{},
+			action: multistep.ActionHalt,
+		},
+		{
+			name:   "update",
+			config: &Config{},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+			calls:  1,
+		},
+		{
+			name:   "offline",
+			config: &Config{Offline: true},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+		},
+		{
+			name:   "update error",
+			config: &Config{},
+			driver: &MockDriver{UpdateErr: errors.New("boom")},
+			action: multistep.ActionHalt,
+			calls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := testState(t, tt.config, tt.driver)
+			step := &StepPkgUpdate{}
+
+			action := step.Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			if got := tt.driver.CallCount("Update"); got != tt.calls {
+				t.Errorf("expected %d Update calls, got %d", tt.calls, got)
+			}
+
+			step.Cleanup(state)
+			if got := len(tt.driver.Calls); got != tt.calls {
+				t.Errorf("expected no driver calls during cleanup, got %d", got-tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// imageRootfsDir returns the directory of the project at path which the
+// rootfs image is flattened into.
+func imageRootfsDir(path string) string {
+	return filepath.Join(path, ".unikraft", "rootfs")
+}
+
+type StepRootfsImage struct {
+}
+
+// Run flattens the layers of the rootfs image into the rootfs, which is a
+// directory owned by the plugin whose contents are replaced, and puts the
+// entrypoint, command and environment of the image in the state as defaults
+// for packaging.
+func (s *StepRootfsImage) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if config.RootfsImage == "" {
+		return multistep.ActionContinue
+	}
+
+	// Never replace a directory the user named.
+	if config.Rootfs != imageRootfsDir(config.Path) {
+		err := fmt.Errorf("rootfs %s is not %s, refusing to replace it with rootfs_image", config.Rootfs, imageRootfsDir(config.Path))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Flattening image %s into %s", config.RootfsImage, config.Rootfs))
+
+	if err := os.RemoveAll(config.Rootfs); err != nil {
+		err := fmt.Errorf("error encountered removing rootfs: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	image, err := flattenImage(config.RootfsImage, config.Architecture, config.Rootfs)
+	if err != nil {
+		err := fmt.Errorf("error encountered flattening image: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// As for containers, the command is passed to the entrypoint.
+	args := append(append([]string{}, image.Entrypoint...), image.Cmd...)
+	if len(args) > 0 {
+		ui.Message(fmt.Sprintf("Image arguments: %q", args))
+	}
+
+	state.Put("image_args", args)
+	state.Put("image_env", image.Env)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup keeps the flattened image, as it is archived into the initramfs.
+func (s *StepRootfsImage) Cleanup(_ multistep.StateBag) {}
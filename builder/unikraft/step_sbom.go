@@ -0,0 +1,257 @@
+package unikraft
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"packer-plugin-unikraft/version"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type StepSbom struct {
+}
+
+// Run writes a CycloneDX software bill of materials listing the kernels built
+// and the components they were built from.  This step is skipped if no sbom
+// path is specified.
+func (s *StepSbom) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if config.Sbom == "" {
+		return multistep.ActionContinue
+	}
+
+	entries, _ := state.Get("entries").([]ArtifactEntry)
+
+	bom, err := newSbom(config.Path, entries)
+	if err != nil {
+		err := fmt.Errorf("error encountered creating sbom: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if err := writeSbom(config.Sbom, bom); err != nil {
+		err := fmt.Errorf("error encountered writing sbom: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Software bill of materials written to %s", config.Sbom))
+	state.Put("sbom", config.Sbom)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup keeps the sbom, as it is part of the artifact.
+func (s *StepSbom) Cleanup(_ multistep.StateBag) {}
+
+// newSbom returns a bill of materials for the kernels built from the project
+// at path.
+func newSbom(path string, entries []ArtifactEntry) (*cdx.BOM, error) {
+	bom := cdx.NewBOM()
+	bom.Metadata = &cdx.Metadata{
+		Tools: &[]cdx.Tool{{
+			Vendor:  "Unikraft",
+			Name:    "packer-plugin-unikraft",
+			Version: version.Version,
+		}},
+		Component: &cdx.Component{
+			BOMRef: "project",
+			Type:   cdx.ComponentTypeApplication,
+			Name:   filepath.Base(path),
+		},
+	}
+
+	var components []cdx.Component
+	var dependencies []cdx.Dependency
+	refs := map[string]bool{}
+
+	for _, entry := range entries {
+		kernel := cdx.Component{
+			BOMRef:  "kernel/" + entry.Platform + "-" + entry.Architecture,
+			Type:    cdx.ComponentTypeApplication,
+			Name:    filepath.Base(entry.Kernel),
+			Version: entry.Version,
+			Properties: &[]cdx.Property{
+				{Name: "unikraft:architecture", Value: entry.Architecture},
+				{Name: "unikraft:platform", Value: entry.Platform},
+			},
+		}
+		if entry.Target != "" {
+			kernel.BOMRef = "kernel/" + entry.Target
+			*kernel.Properties = append(*kernel.Properties, cdx.Property{Name: "unikraft:target", Value: entry.Target})
+		}
+		if entry.Sha256 != "" {
+			kernel.Hashes = &[]cdx.Hash{{Algorithm: cdx.HashAlgoSHA256, Value: entry.Sha256}}
+		}
+		components = append(components, kernel)
+
+		var dependsOn []string
+		for _, comp := range entry.Components {
+			ref := comp.Type + "/" + comp.Name
+			dependsOn = append(dependsOn, ref)
+
+			if refs[ref] {
+				continue
+			}
+			refs[ref] = true
+
+			c, err := sbomComponent(ref, comp)
+			if err != nil {
+				return nil, err
+			}
+			components = append(components, c)
+		}
+
+		dependencies = append(dependencies, cdx.Dependency{
+			Ref:          kernel.BOMRef,
+			Dependencies: &dependsOn,
+		})
+	}
+
+	if len(components) > 0 {
+		bom.Components = &components
+	}
+	if len(dependencies) > 0 {
+		bom.Dependencies = &dependencies
+	}
+
+	return bom, nil
+}
+
+// sbomComponent describes a Unikraft component, e.g. a library, in the sbom.
+func sbomComponent(ref string, comp Component) (cdx.Component, error) {
+	c := cdx.Component{
+		BOMRef:  ref,
+		Type:    cdx.ComponentTypeLibrary,
+		Name:    comp.Name,
+		Version: comp.Version,
+		Properties: &[]cdx.Property{
+			{Name: "unikraft:type", Value: comp.Type},
+		},
+	}
+
+	switch comp.Type {
+	case "core":
+		c.Type = cdx.ComponentTypeFramework
+	case "app":
+		c.Type = cdx.ComponentTypeApplication
+	}
+
+	if comp.Source != "" {
+		refType := cdx.ERTypeDistribution
+		if strings.HasSuffix(comp.Source, ".git") {
+			refType = cdx.ERTypeVCS
+		}
+
+		c.ExternalReferences = &[]cdx.ExternalReference{{
+			Type: refType,
+			URL:  comp.Source,
+		}}
+	}
+
+	if comp.Path != "" {
+		sum, err := dirDigest(comp.Path)
+		if err != nil {
+			return c, fmt.Errorf("could not checksum %s: %w", ref, err)
+		}
+
+		c.Hashes = &[]cdx.Hash{{Algorithm: cdx.HashAlgoSHA256, Value: sum}}
+	}
+
+	return c, nil
+}
+
+// dirDigest returns a hex encoded SHA-256 digest over the relative paths and
+// contents of the files in dir, in lexical order.  Git metadata is skipped,
+// such that the digest only depends on the checked out sources.
+func dirDigest(dir string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(h, "%s\x00link\x00%s\n", filepath.ToSlash(rel), target)
+
+		case d.Type().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			fh := sha256.New()
+			if _, err := io.Copy(fh, f); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(h, "%s\x00file\x00%x\n", filepath.ToSlash(rel), fh.Sum(nil))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeSbom writes the bill of materials to path in the CycloneDX JSON format.
+func writeSbom(path string, bom *cdx.BOM) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := cdx.NewBOMEncoder(f, cdx.BOMFileFormatJSON).SetPretty(true).Encode(bom); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,156 @@
+package unikraft
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cdx "github.com/CycloneDX/cyclonedx-go"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepSbom(t *testing.T) {
+	dir := t.TempDir()
+
+	musl := filepath.Join(dir, "libs", "musl")
+	if err := os.MkdirAll(filepath.Join(musl, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(musl, "Makefile.uk"), []byte("LIBMUSL_VERSION=1.2.3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	components := []Component{
+		{Type: "core", Name: "unikraft", Version: "stable", Source: "https://github.com/unikraft/unikraft.git"},
+		{Type: "lib", Name: "musl", Version: "stable", Source: "https://github.com/unikraft/lib-musl.git", Path: musl},
+	}
+
+	entries := []ArtifactEntry{
+		{
+			Kernel:       filepath.Join(dir, "nginx_qemu-x86_64"),
+			Architecture: "x86_64",
+			Platform:     "qemu",
+			Target:       "nginx-qemu-x86_64",
+			Version:      "0.16.1",
+			Sha256:       "abc",
+			Components:   components,
+		},
+		{
+			Kernel:       filepath.Join(dir, "nginx_fc-x86_64"),
+			Architecture: "x86_64",
+			Platform:     "fc",
+			Target:       "nginx-fc-x86_64",
+			Components:   components,
+		},
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		state := testState(t, &Config{Path: dir}, &MockDriver{})
+		state.Put("entries", entries)
+
+		action := (&StepSbom{}).Run(context.Background(), state)
+		assertAction(t, state, action, multistep.ActionContinue)
+
+		if _, ok := state.GetOk("sbom"); ok {
+			t.Error("expected no sbom in the state")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		path := filepath.Join(dir, "out", "sbom.cdx.json")
+
+		state := testState(t, &Config{Path: dir, Sbom: path}, &MockDriver{})
+		state.Put("entries", entries)
+
+		action := (&StepSbom{}).Run(context.Background(), state)
+		assertAction(t, state, action, multistep.ActionContinue)
+
+		if got := state.Get("sbom"); got != path {
+			t.Errorf("expected sbom %s in the state, got %v", path, got)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		var bom cdx.BOM
+		if err := cdx.NewBOMDecoder(f, cdx.BOMFileFormatJSON).Decode(&bom); err != nil {
+			t.Fatal(err)
+		}
+
+		if bom.Components == nil || len(*bom.Components) != 4 {
+			t.Fatalf("expected 2 kernels and 2 components, got %+v", bom.Components)
+		}
+
+		var lib *cdx.Component
+		for i, c := range *bom.Components {
+			if c.BOMRef == "lib/musl" {
+				lib = &(*bom.Components)[i]
+			}
+		}
+		if lib == nil {
+			t.Fatal("expected musl in the sbom")
+		}
+		if lib.Type != cdx.ComponentTypeLibrary || lib.Version != "stable" {
+			t.Errorf("unexpected component %+v", lib)
+		}
+		if lib.ExternalReferences == nil || (*lib.ExternalReferences)[0].URL != components[1].Source {
+			t.Errorf("expected the source of musl, got %+v", lib.ExternalReferences)
+		}
+
+		sum, err := dirDigest(musl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lib.Hashes == nil || (*lib.Hashes)[0].Value != sum {
+			t.Errorf("expected checksum %s, got %+v", sum, lib.Hashes)
+		}
+
+		if bom.Dependencies == nil || len(*bom.Dependencies) != 2 {
+			t.Errorf("expected the dependencies of both kernels, got %+v", bom.Dependencies)
+		}
+	})
+
+	t.Run("unreadable component", func(t *testing.T) {
+		broken := []ArtifactEntry{{Components: []Component{{Type: "lib", Name: "gone", Path: filepath.Join(dir, "gone")}}}}
+
+		state := testState(t, &Config{Path: dir, Sbom: filepath.Join(dir, "sbom.json")}, &MockDriver{})
+		state.Put("entries", broken)
+
+		action := (&StepSbom{}).Run(context.Background(), state)
+		assertAction(t, state, action, multistep.ActionHalt)
+	})
+}
+
+func TestDirDigest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := dirDigest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Git metadata does not change the digest.
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := dirDigest(dir); err != nil || after != before {
+		t.Errorf("expected digest %s, got %s (%v)", before, after, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := dirDigest(dir); err != nil || after == before {
+		t.Errorf("expected the digest to change, got %s (%v)", after, err)
+	}
+}
@@ -11,7 +11,9 @@ import (
 type StepSet struct {
 }
 
-// Run calls `kraft set` to set specific symbols not found in the configuration file.
+// Run overrides the KConfig symbols given in the configuration.
+// The symbols are only applied when the project is configured and are never
+// written to the Kraftfile.
 func (s *StepSet) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
 	ui := state.Get("ui").(packersdk.Ui)
 	config, ok := state.Get("config").(*Config)
@@ -22,74 +24,50 @@ func (s *StepSet) Run(_ context.Context, state multistep.StateBag) multistep.Ste
 		return multistep.ActionHalt
 	}
 
-	if config.Options != "" {
-		ui.Message("Setting symbols is currently disabled and will be updated in future releases.")
+	if len(config.KConfig) == 0 {
+		return multistep.ActionContinue
 	}
 
-	// driver := state.Get("driver").(Driver)
+	driver := state.Get("driver").(Driver)
 
-	// options := make(map[string]string)
-	// // Split config.Options on ' '
-	// for _, option := range strings.Split(config.Options, " ") {
-	// 	// Split option on '='
-	// 	splitOption := strings.Split(option, "=")
-	// 	// If option is not a key=value pair, skip it
-	// 	if len(splitOption) != 2 {
-	// 		continue
-	// 	}
-	// 	// Add option to options map
-	// 	options[splitOption[0]] = splitOption[1]
-	// }
-
-	// if len(options) == 0 {
-	// 	return multistep.ActionContinue
-	// }
-	// err := driver.Set(options)
-	// if err != nil {
-	// 	err := fmt.Errorf("error encountered setting symbols: %s", err)
-	// 	state.Put("error", err)
-	// 	ui.Error(err.Error())
-	// 	return multistep.ActionHalt
-	// }
+	err := driver.Set(config.KConfig)
+	if err != nil {
+		err := fmt.Errorf("error encountered setting symbols: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
 
 	return multistep.ActionContinue
 }
 
-// Cleanup unsets the symbols set in the Run step.
-// Setting and unsetting symbols might create unexpected results.
+// Cleanup drops the symbols set in the Run step, such that they do not leak
+// into any subsequent use of the driver.
 func (s *StepSet) Cleanup(state multistep.StateBag) {
-	// ui := state.Get("ui").(packersdk.Ui)
-	// config, ok := state.Get("config").(*Config)
-	// if !ok {
-	// 	err := fmt.Errorf("error encountered obtaining kraft config")
-	// 	state.Put("error", err)
-	// 	ui.Error(err.Error())
-	// 	return
-	// }
-
-	// driver := state.Get("driver").(Driver)
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return
+	}
 
-	// options := make(map[string]string, 0)
-	// // Split config.Options on ' '
-	// for _, option := range strings.Split(config.Options, " ") {
-	// 	// Split option on '='
-	// 	splitOption := strings.Split(option, "=")
-	// 	// If option is not a key=value pair, skip it
-	// 	if len(splitOption) != 2 {
-	// 		continue
-	// 	}
+	if len(config.KConfig) == 0 {
+		return
+	}
 
-	// 	options[splitOption[0]] = "n"
-	// }
+	driver := state.Get("driver").(Driver)
 
-	// if len(options) == 0 {
-	// 	return
-	// }
+	options := make([]string, 0, len(config.KConfig))
+	for k := range config.KConfig {
+		options = append(options, k)
+	}
 
-	// err := driver.Set(options)
-	// if err != nil {
-	// 	err := fmt.Errorf("error encountered setting symbols: %s", err)
-	// 	state.Put("error", err)
-	// 	ui.Error(err.Error())
-	// }
+	err := driver.Unset(options)
+	if err != nil {
+		err := fmt.Errorf("error encountered unsetting symbols: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+	}
 }
@@ -0,0 +1,84 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepSet(t *testing.T) {
+	kconfig := map[string]string{
+		"CONFIG_LIBPOSIX_SOCKET": "y",
+		"CONFIG_LIBVFSCORE":      "y",
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		driver *MockDriver
+		action multistep.StepAction
+		set    bool
+		unset  []string
+	}{
+		{
+			name:   "missing config",
+			config: nil,
+			driver: &MockDriver{},
+			action: multistep.ActionHalt,
+		},
+		{
+			name:   "no symbols",
+			config: &Config{},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+		},
+		{
+			name:   "symbols",
+			config: &Config{KConfig: kconfig},
+			driver: &MockDriver{},
+			action: multistep.ActionContinue,
+			set:    true,
+			unset:  []string{"CONFIG_LIBPOSIX_SOCKET", "CONFIG_LIBVFSCORE"},
+		},
+		{
+			name:   "set error",
+			config: &Config{KConfig: kconfig},
+			driver: &MockDriver{SetErr: errors.New("boom")},
+			action: multistep.ActionHalt,
+			set:    true,
+			unset:  []string{"CONFIG_LIBPOSIX_SOCKET", "CONFIG_LIBVFSCORE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := testState(t, tt.config, tt.driver)
+			step := &StepSet{}
+
+			action := step.Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			if set := tt.driver.CallCount("Set") > 0; set != tt.set {
+				t.Fatalf("expected Set called to be %t", tt.set)
+			}
+			if args := tt.driver.LastArgs("Set"); tt.set && !reflect.DeepEqual(args[0], kconfig) {
+				t.Errorf("expected symbols %v, got %v", kconfig, args[0])
+			}
+
+			step.Cleanup(state)
+
+			var unset []string
+			if args := tt.driver.LastArgs("Unset"); args != nil {
+				unset = args[0].([]string)
+			}
+			sort.Strings(unset)
+			if !reflect.DeepEqual(unset, tt.unset) {
+				t.Errorf("expected unset symbols %v, got %v", tt.unset, unset)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package unikraft
+
+import (
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// testState returns a state bag as populated by Builder.Run, using the given
+// configuration and driver. A nil config is left out of the state.
+func testState(t *testing.T, config *Config, driver Driver) multistep.StateBag {
+	t.Helper()
+
+	state := new(multistep.BasicStateBag)
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("driver", driver)
+	if config != nil {
+		state.Put("config", config)
+	}
+
+	return state
+}
+
+// assertAction checks the step action and whether an error was put in the
+// state accordingly.
+func assertAction(t *testing.T, state multistep.StateBag, got, want multistep.StepAction) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("expected action %v, got %v", want, got)
+	}
+
+	_, hasErr := state.GetOk("error")
+	if want == multistep.ActionHalt && !hasErr {
+		t.Fatal("expected an error in the state")
+	}
+	if want == multistep.ActionContinue && hasErr {
+		t.Fatalf("unexpected error in the state: %s", state.Get("error"))
+	}
+}
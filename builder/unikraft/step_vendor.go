@@ -0,0 +1,62 @@
+package unikraft
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+type StepVendor struct {
+}
+
+// Run saves the components of the project, i.e. the Unikraft core, its
+// libraries and templates, to the vendor directory together with a manifest
+// index describing them.
+func (s *StepVendor) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	config, ok := state.Get("config").(*Config)
+	if !ok {
+		err := fmt.Errorf("error encountered obtaining kraft config")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	driver := state.Get("driver").(Driver)
+
+	ui.Say(fmt.Sprintf("Vendoring the components of %s into %s", config.Path, config.VendorDir))
+
+	components, err := driver.Vendor(ctx, VendorOptions{
+		Path:         config.Path,
+		Kraftfile:    config.Kraftfile,
+		Architecture: config.Architecture,
+		Platform:     config.Platform,
+		Output:       config.VendorDir,
+	})
+	if err != nil {
+		err := fmt.Errorf("error encountered vendoring components: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if len(components) == 0 {
+		err := fmt.Errorf("no components of %s were vendored", config.Path)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	for _, comp := range components {
+		ui.Message(fmt.Sprintf("%s/%s %s: %s", comp.Type, comp.Name, comp.Version, comp.Path))
+	}
+
+	state.Put("vendor_dir", config.VendorDir)
+
+	return multistep.ActionContinue
+}
+
+// Cleanup keeps the vendored components, as they are the artifact.
+func (s *StepVendor) Cleanup(_ multistep.StateBag) {}
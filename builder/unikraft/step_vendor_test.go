@@ -0,0 +1,67 @@
+package unikraft
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepVendor(t *testing.T) {
+	vendored := []Component{{Type: "core", Name: "unikraft", Version: "stable", Path: "/mirror/core/unikraft/stable.tar.gz"}}
+
+	tests := []struct {
+		name   string
+		driver *MockDriver
+		action multistep.StepAction
+	}{
+		{
+			name:   "vendor",
+			driver: &MockDriver{VendorComponents: vendored},
+			action: multistep.ActionContinue,
+		},
+		{
+			name:   "nothing vendored",
+			driver: &MockDriver{},
+			action: multistep.ActionHalt,
+		},
+		{
+			name:   "vendor error",
+			driver: &MockDriver{VendorErr: errors.New("boom")},
+			action: multistep.ActionHalt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Path:         "/tmp/app",
+				Kraftfile:    "Kraftfile.dev",
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				VendorDir:    "/mirror",
+			}
+			state := testState(t, config, tt.driver)
+
+			action := (&StepVendor{}).Run(context.Background(), state)
+			assertAction(t, state, action, tt.action)
+
+			want := VendorOptions{
+				Path:         "/tmp/app",
+				Kraftfile:    "Kraftfile.dev",
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				Output:       "/mirror",
+			}
+			if args := tt.driver.LastArgs("Vendor"); len(args) != 1 || args[0] != want {
+				t.Errorf("expected options %+v, got %+v", want, args)
+			}
+
+			_, ok := state.GetOk("vendor_dir")
+			if ok != (tt.action == multistep.ActionContinue) {
+				t.Errorf("unexpected vendor_dir in the state: %v", state.Get("vendor_dir"))
+			}
+		})
+	}
+}
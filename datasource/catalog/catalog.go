@@ -0,0 +1,51 @@
+package catalog
+
+import (
+	"context"
+
+	"kraftkit.sh/manifest"
+	"kraftkit.sh/packmanager"
+	"kraftkit.sh/unikraft"
+)
+
+// query returns the packages of the catalog matching the configuration.
+func (c *Config) query(ctx context.Context) ([]Package, error) {
+	qopts := []packmanager.QueryOption{
+		packmanager.WithName(c.Name),
+		packmanager.WithVersion(c.Version),
+		packmanager.WithArchitecture(c.Architecture),
+		packmanager.WithPlatform(c.Platform),
+		packmanager.WithRemote(!c.Offline),
+		packmanager.WithLocal(true),
+	}
+
+	if c.Type != "" {
+		qopts = append(qopts, packmanager.WithTypes(unikraft.ComponentType(c.Type)))
+	}
+
+	found, err := packmanager.G(ctx).Catalog(ctx, qopts...)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := make([]Package, 0, len(found))
+	for _, p := range found {
+		pkg := Package{
+			Name:    p.Name(),
+			Version: p.Version(),
+			Type:    string(p.Type()),
+			Format:  p.Format().String(),
+		}
+
+		// Packages from registries are retrieved by their reference, while
+		// components are retrieved from the origin of their manifest.
+		pkg.Source = p.String()
+		if m, ok := p.Metadata().(*manifest.Manifest); ok && m.Origin != "" {
+			pkg.Source = m.Origin
+		}
+
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
@@ -0,0 +1,86 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,DatasourceOutput,Package
+
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+type Config struct {
+	// The name of the package to look up, e.g. `nginx`.
+	Name string `mapstructure:"name" required:"true"`
+	// The version of the package, e.g. `stable` or a tag.  By default all
+	// versions are returned.
+	Version string `mapstructure:"version"`
+	// The type of the package, e.g. `app`, `lib` or `core`.
+	Type string `mapstructure:"type"`
+	// The architecture the package must support, e.g. `x86_64`.
+	Architecture string `mapstructure:"architecture"`
+	// The platform the package must support, e.g. `qemu`.
+	Platform string `mapstructure:"platform"`
+	// Path to a directory holding an `index.yaml` manifest index to query
+	// instead of the default manifests.
+	ManifestMirror string `mapstructure:"manifest_mirror"`
+	// Only query the manifests available locally, without updating them or
+	// querying registries.
+	Offline bool `mapstructure:"offline"`
+	// Log level to use.
+	LogLevel string `mapstructure:"log_level"`
+}
+
+// Package describes a package of the catalog.
+type Package struct {
+	// Name of the package.
+	Name string `mapstructure:"name"`
+	// Version of the package.
+	Version string `mapstructure:"version"`
+	// Type of the package, e.g. `app`.
+	Type string `mapstructure:"type"`
+	// Format of the package, e.g. `manifest` or `oci`.
+	Format string `mapstructure:"format"`
+	// Source the package is retrieved from.
+	Source string `mapstructure:"source"`
+}
+
+type DatasourceOutput struct {
+	// The matching packages, latest version first.
+	Packages []Package `mapstructure:"packages"`
+	// The distinct versions of the matching packages, latest first.
+	Versions []string `mapstructure:"versions"`
+	// The latest version of the matching packages.
+	Version string `mapstructure:"version"`
+	// The source of the latest matching package.
+	Source string `mapstructure:"source"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, nil, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if c.Name == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("name must be specified"))
+	}
+
+	if c.ManifestMirror != "" {
+		if c.ManifestMirror, err = filepath.Abs(c.ManifestMirror); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve manifest_mirror: %s", err))
+		} else if _, err := os.Stat(filepath.Join(c.ManifestMirror, "index.yaml")); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("manifest_mirror %s holds no index.yaml: %s", c.ManifestMirror, err))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type Datasource struct {
+	config Config
+}
+
+func (d *Datasource) ConfigSpec() hcldec.ObjectSpec {
+	return d.config.FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Configure(raws ...interface{}) error {
+	return d.config.Prepare(raws...)
+}
+
+func (d *Datasource) OutputSpec() hcldec.ObjectSpec {
+	return (&DatasourceOutput{}).FlatMapstructure().HCL2Spec()
+}
+
+// Execute queries the package catalog of KraftKit.  Data sources have no UI,
+// so the log of KraftKit is written to the log of Packer.
+func (d *Datasource) Execute() (cty.Value, error) {
+	ui := &packersdk.BasicUi{
+		Writer:      os.Stderr,
+		ErrorWriter: os.Stderr,
+	}
+
+	ctx, cleanup, err := unikraft.KraftCommandContext(context.Background(), ui, unikraft.KraftOptions{
+		LogLevel:       d.config.LogLevel,
+		Offline:        d.config.Offline,
+		ManifestMirror: d.config.ManifestMirror,
+	})
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("error encountered initialising kraft: %s", err)
+	}
+	defer cleanup()
+
+	packages, err := d.config.query(ctx)
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("error encountered querying the catalog: %s", err)
+	}
+
+	if len(packages) == 0 {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("no package matches %s", d.config.Name)
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(newOutput(packages), d.OutputSpec()), nil
+}
@@ -0,0 +1,55 @@
+package catalog
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/acctest"
+)
+
+//go:embed test-fixtures/template.pkr.hcl
+var testDatasourceHCL2Basic string
+
+// Run with: PACKER_ACC=1 go test -count 1 -v ./datasource/catalog/data_acc_test.go  -timeout=120m
+func TestAccCatalogDatasource(t *testing.T) {
+	testCase := &acctest.PluginTestCase{
+		Name: "unikraft_catalog_datasource_basic_test",
+		Setup: func() error {
+			return nil
+		},
+		Teardown: func() error {
+			return nil
+		},
+		Template: testDatasourceHCL2Basic,
+		Type:     "unikraft-catalog",
+		Check: func(buildCommand *exec.Cmd, logfile string) error {
+			if buildCommand.ProcessState != nil {
+				if buildCommand.ProcessState.ExitCode() != 0 {
+					return fmt.Errorf("bad exit code. Logfile: %s", logfile)
+				}
+			}
+
+			logs, err := os.Open(logfile)
+			if err != nil {
+				return fmt.Errorf("unable find %s", logfile)
+			}
+			defer logs.Close()
+
+			logsBytes, err := io.ReadAll(logs)
+			if err != nil {
+				return fmt.Errorf("unable to read %s", logfile)
+			}
+
+			if matched, _ := regexp.Match("nginx version: 0.16.1", logsBytes); !matched {
+				t.Fatalf("logs do not contain the latest nginx version %q", logsBytes)
+			}
+			return nil
+		},
+	}
+	acctest.TestPlugin(t, testCase)
+}
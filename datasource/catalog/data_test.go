@@ -0,0 +1,116 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDatasource_ImplementsDatasource(t *testing.T) {
+	var _ packersdk.Datasource = &Datasource{}
+}
+
+func TestDatasource_Configure(t *testing.T) {
+	mirror := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mirror, "index.yaml"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		err  string
+	}{
+		{
+			name: "minimal",
+			raw:  map[string]interface{}{"name": "nginx"},
+		},
+		{
+			name: "missing name",
+			raw:  map[string]interface{}{"type": "app"},
+			err:  "name must be specified",
+		},
+		{
+			name: "manifest mirror",
+			raw: map[string]interface{}{
+				"name":            "nginx",
+				"manifest_mirror": mirror,
+				"offline":         true,
+			},
+		},
+		{
+			name: "manifest mirror without index",
+			raw: map[string]interface{}{
+				"name":            "nginx",
+				"manifest_mirror": t.TempDir(),
+			},
+			err: "holds no index.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Datasource
+			err := d.Configure(tt.raw)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	versions := []string{"stable", "0.9.0", "v0.16.1", "staging", "0.16.1-rc1", "0.16.0", "v0.16"}
+	packages := make([]Package, 0, len(versions))
+	for _, v := range versions {
+		packages = append(packages, Package{Name: "nginx", Version: v})
+	}
+
+	output := newOutput(packages)
+
+	want := []string{"v0.16.1", "0.16.1-rc1", "0.16.0", "v0.16", "0.9.0", "stable", "staging"}
+	if !reflect.DeepEqual(output.Versions, want) {
+		t.Errorf("expected versions %v, got %v", want, output.Versions)
+	}
+	if output.Version != "v0.16.1" {
+		t.Errorf("expected the latest version v0.16.1, got %s", output.Version)
+	}
+}
+
+func TestDatasourceOutput(t *testing.T) {
+	var d Datasource
+
+	output := newOutput([]Package{
+		{Name: "nginx", Version: "stable", Type: "app", Format: "manifest", Source: "https://github.com/unikraft/app-nginx.git"},
+		{Name: "nginx", Version: "stable", Type: "app", Format: "manifest", Source: "https://github.com/unikraft/app-nginx.git"},
+		{Name: "unikraft.org/nginx", Version: "1.25", Type: "app", Format: "oci", Source: "unikraft.org/nginx:1.25"},
+	})
+
+	value := hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec())
+
+	if got := value.GetAttr("version"); !got.RawEquals(cty.StringVal("1.25")) {
+		t.Errorf("expected version 1.25, got %#v", got)
+	}
+	if got := value.GetAttr("source"); !got.RawEquals(cty.StringVal("unikraft.org/nginx:1.25")) {
+		t.Errorf("expected the source of the latest package, got %#v", got)
+	}
+	if got := value.GetAttr("versions").LengthInt(); got != 2 {
+		t.Errorf("expected 2 distinct versions, got %d", got)
+	}
+	if got := value.GetAttr("packages").LengthInt(); got != 3 {
+		t.Errorf("expected 3 packages, got %d", got)
+	}
+}
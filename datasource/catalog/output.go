@@ -0,0 +1,88 @@
+package catalog
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// releaseVersion matches versions which are ordered numerically, e.g.
+// `v0.16.1` or `1.25-rc1`.
+var releaseVersion = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)(?:-(.+))?$`)
+
+// newOutput returns the output of the data source for the given packages,
+// ordering them from the latest version to the oldest.
+func newOutput(packages []Package) DatasourceOutput {
+	sort.SliceStable(packages, func(i, j int) bool {
+		return compareVersions(packages[i].Version, packages[j].Version) > 0
+	})
+
+	output := DatasourceOutput{
+		Packages: packages,
+		Versions: []string{},
+	}
+
+	seen := map[string]bool{}
+	for _, p := range packages {
+		if seen[p.Version] {
+			continue
+		}
+		seen[p.Version] = true
+
+		output.Versions = append(output.Versions, p.Version)
+	}
+
+	if len(packages) > 0 {
+		output.Version = packages[0].Version
+		output.Source = packages[0].Source
+	}
+
+	return output
+}
+
+// compareVersions returns a positive number if a is later than b, a negative
+// number if it is older, and zero if they are equal.  Release versions are
+// compared numerically and are later than any other version, e.g. a channel
+// name like `stable`, which are compared lexically.
+func compareVersions(a, b string) int {
+	ma := releaseVersion.FindStringSubmatch(a)
+	mb := releaseVersion.FindStringSubmatch(b)
+
+	switch {
+	case ma == nil && mb == nil:
+		return strings.Compare(b, a)
+	case ma == nil:
+		return -1
+	case mb == nil:
+		return 1
+	}
+
+	na := strings.Split(ma[1], ".")
+	nb := strings.Split(mb[1], ".")
+	for i := 0; i < len(na) || i < len(nb); i++ {
+		var x, y int
+		if i < len(na) {
+			x, _ = strconv.Atoi(na[i])
+		}
+		if i < len(nb) {
+			y, _ = strconv.Atoi(nb[i])
+		}
+
+		if x != y {
+			return x - y
+		}
+	}
+
+	// A pre-release is older than the release itself.
+	switch {
+	case ma[2] == mb[2]:
+		return 0
+	case ma[2] == "":
+		return 1
+	case mb[2] == "":
+		return -1
+	}
+
+	return strings.Compare(ma[2], mb[2])
+}
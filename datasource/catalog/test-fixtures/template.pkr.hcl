@@ -0,0 +1,33 @@
+data "unikraft-catalog" "nginx" {
+  // Name of the package to look up
+  name = "nginx"
+
+  // Type of the package
+  type = "app"
+
+  // Manifests to query instead of the default ones
+  manifest_mirror = "test-fixtures/manifests"
+
+  // Do not update the manifests
+  offline = true
+}
+
+locals {
+  nginx_version = data.unikraft-catalog.nginx.version
+}
+
+source "null" "example" {
+  communicator = "none"
+}
+
+build {
+  sources = [
+    "source.null.example"
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      "echo nginx version: ${local.nginx_version}",
+    ]
+  }
+}
@@ -0,0 +1,85 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,DatasourceOutput,Target
+
+package kraftfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+type Config struct {
+	// The path to the project directory.
+	Path string `mapstructure:"path" required:"true"`
+	// Path to the Kraftfile to parse, relative to the project directory.  By
+	// default the Kraftfile is looked up in the project directory.
+	Kraftfile string `mapstructure:"kraftfile"`
+	// Log level to use.
+	LogLevel string `mapstructure:"log_level"`
+}
+
+// Target describes a target of the Kraftfile.
+type Target struct {
+	// Name of the target, e.g. `nginx-qemu-x86_64-initrd`.
+	Name string `mapstructure:"name"`
+	// Architecture of the target, e.g. `x86_64`.
+	Architecture string `mapstructure:"architecture"`
+	// Platform of the target, e.g. `qemu`.
+	Platform string `mapstructure:"platform"`
+	// KConfig symbols set by the target.
+	KConfig map[string]string `mapstructure:"kconfig"`
+}
+
+type DatasourceOutput struct {
+	// The name of the project.
+	Name string `mapstructure:"name"`
+	// The targets of the project.
+	Targets []Target `mapstructure:"targets"`
+	// The runtime the project is built with, e.g. `unikraft.org/nginx:latest`.
+	Runtime string `mapstructure:"runtime"`
+	// The root filesystem of the project.
+	Rootfs string `mapstructure:"rootfs"`
+	// The command of the unikernel.
+	Command []string `mapstructure:"command"`
+	// The environment variables of the unikernel.
+	Env map[string]string `mapstructure:"env"`
+	// The labels of the project.
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, nil, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if c.Path == "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("path must be specified"))
+	} else if c.Path, err = filepath.Abs(c.Path); err != nil {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve path: %s", err))
+	} else if _, err := os.Stat(c.Path); err != nil {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("path %s does not exist: %s", c.Path, err))
+	}
+
+	if c.Kraftfile != "" && c.Path != "" {
+		kraftfile := c.Kraftfile
+		if !filepath.IsAbs(kraftfile) {
+			kraftfile = filepath.Join(c.Path, kraftfile)
+		}
+
+		if _, err := os.Stat(kraftfile); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("kraftfile %s does not exist: %s", kraftfile, err))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package kraftfile
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/acctest"
+)
+
+//go:embed test-fixtures/template.pkr.hcl
+var testDatasourceHCL2Basic string
+
+// Run with: PACKER_ACC=1 go test -count 1 -v ./datasource/kraftfile/data_acc_test.go  -timeout=120m
+func TestAccKraftfileDatasource(t *testing.T) {
+	testCase := &acctest.PluginTestCase{
+		Name: "unikraft_kraftfile_datasource_basic_test",
+		Setup: func() error {
+			return nil
+		},
+		Teardown: func() error {
+			return nil
+		},
+		Template: testDatasourceHCL2Basic,
+		Type:     "unikraft-kraftfile",
+		Check: func(buildCommand *exec.Cmd, logfile string) error {
+			if buildCommand.ProcessState != nil {
+				if buildCommand.ProcessState.ExitCode() != 0 {
+					return fmt.Errorf("bad exit code. Logfile: %s", logfile)
+				}
+			}
+
+			logs, err := os.Open(logfile)
+			if err != nil {
+				return fmt.Errorf("unable find %s", logfile)
+			}
+			defer logs.Close()
+
+			logsBytes, err := io.ReadAll(logs)
+			if err != nil {
+				return fmt.Errorf("unable to read %s", logfile)
+			}
+
+			if matched, _ := regexp.Match("target: nginx-qemu-x86_64-initrd qemu/x86_64", logsBytes); !matched {
+				t.Fatalf("logs do not contain the targets of the Kraftfile %q", logsBytes)
+			}
+			return nil
+		},
+	}
+	acctest.TestPlugin(t, testCase)
+}
@@ -0,0 +1,123 @@
+package kraftfile
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDatasource_ImplementsDatasource(t *testing.T) {
+	var _ packersdk.Datasource = &Datasource{}
+}
+
+func TestDatasource_Configure(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		err  string
+	}{
+		{
+			name: "default kraftfile",
+			raw:  map[string]interface{}{"path": "test-fixtures/app"},
+		},
+		{
+			name: "kraftfile",
+			raw: map[string]interface{}{
+				"path":      "test-fixtures/app",
+				"kraftfile": "Kraftfile",
+			},
+		},
+		{
+			name: "missing path",
+			raw:  map[string]interface{}{},
+			err:  "path must be specified",
+		},
+		{
+			name: "missing project",
+			raw:  map[string]interface{}{"path": "test-fixtures/missing"},
+			err:  "does not exist",
+		},
+		{
+			name: "missing kraftfile",
+			raw: map[string]interface{}{
+				"path":      "test-fixtures/app",
+				"kraftfile": "Kraftfile.dev",
+			},
+			err: "kraftfile",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Datasource
+			err := d.Configure(tt.raw)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !filepath.IsAbs(d.config.Path) {
+				t.Errorf("expected an absolute path, got %s", d.config.Path)
+			}
+		})
+	}
+}
+
+func TestDatasourceOutput(t *testing.T) {
+	var d Datasource
+
+	output := &DatasourceOutput{
+		Name: "nginx",
+		Targets: []Target{
+			{
+				Name:         "nginx-qemu-x86_64-initrd",
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				KConfig:      map[string]string{"CONFIG_LIBVFSCORE_AUTOMOUNT_EINITRD": "y"},
+			},
+			{
+				Name:         "nginx-fc-x86_64-initrd",
+				Architecture: "x86_64",
+				Platform:     "fc",
+				KConfig:      map[string]string{},
+			},
+		},
+		Rootfs:  "./rootfs",
+		Command: []string{"/nginx/sbin/nginx", "-c", "/nginx/conf/nginx.conf"},
+		Env:     map[string]string{"NGINX_PORT": "80"},
+	}
+
+	value := hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec())
+
+	targets := value.GetAttr("targets")
+	if targets.LengthInt() != 2 {
+		t.Fatalf("expected 2 targets, got %d", targets.LengthInt())
+	}
+
+	first := targets.Index(cty.NumberIntVal(0))
+	if got := first.GetAttr("platform"); !got.RawEquals(cty.StringVal("qemu")) {
+		t.Errorf("expected platform qemu, got %#v", got)
+	}
+	if got := first.GetAttr("kconfig").Index(cty.StringVal("CONFIG_LIBVFSCORE_AUTOMOUNT_EINITRD")); !got.RawEquals(cty.StringVal("y")) {
+		t.Errorf("expected the kconfig of the target, got %#v", got)
+	}
+	if got := value.GetAttr("command").LengthInt(); got != 3 {
+		t.Errorf("expected 3 command arguments, got %d", got)
+	}
+	if got := value.GetAttr("env").Index(cty.StringVal("NGINX_PORT")); !got.RawEquals(cty.StringVal("80")) {
+		t.Errorf("expected the environment, got %#v", got)
+	}
+	if got := value.GetAttr("runtime"); !got.RawEquals(cty.StringVal("")) {
+		t.Errorf("expected no runtime, got %#v", got)
+	}
+}
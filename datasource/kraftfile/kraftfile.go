@@ -0,0 +1,114 @@
+package kraftfile
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"kraftkit.sh/pack"
+	"kraftkit.sh/packmanager"
+	"kraftkit.sh/unikraft"
+	"kraftkit.sh/unikraft/app"
+)
+
+// parse interprets the project as described by its Kraftfile, merged with
+// the template it is based on, if any.
+func (c *Config) parse(ctx context.Context) (*DatasourceOutput, error) {
+	popts := []app.ProjectOption{
+		app.WithProjectWorkdir(c.Path),
+	}
+
+	if len(c.Kraftfile) > 0 {
+		popts = append(popts, app.WithProjectKraftfile(c.Kraftfile))
+	} else {
+		popts = append(popts, app.WithProjectDefaultKraftfiles())
+	}
+
+	project, err := app.NewProjectFromOptions(ctx, popts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if project.Template() != nil {
+		if project, err = mergeTemplate(ctx, project, c.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	output := &DatasourceOutput{
+		Name:    project.Name(),
+		Targets: []Target{},
+		Rootfs:  project.Rootfs(),
+		Command: project.Command(),
+		Env:     project.Env(),
+		Labels:  project.Labels(),
+	}
+
+	if rt := project.Runtime(); rt != nil {
+		output.Runtime = rt.Name()
+		if rt.Version() != "" {
+			output.Runtime += ":" + rt.Version()
+		}
+	}
+
+	for _, targ := range project.Targets() {
+		t := Target{
+			Name:         targ.Name(),
+			Architecture: targ.Architecture().Name(),
+			Platform:     targ.Platform().Name(),
+			KConfig:      map[string]string{},
+		}
+
+		for k, v := range targ.KConfig() {
+			t.KConfig[k] = v.Value
+		}
+
+		output.Targets = append(output.Targets, t)
+	}
+
+	return output, nil
+}
+
+// mergeTemplate merges the template of the project into it, as for a build,
+// such that the project overrides the template.  The template is pulled into
+// the project directory unless it is already there.
+func mergeTemplate(ctx context.Context, project app.Application, workdir string) (app.Application, error) {
+	template := project.Template()
+
+	if _, err := os.Stat(template.Path()); err != nil {
+		qopts := []packmanager.QueryOption{
+			packmanager.WithName(template.Name()),
+			packmanager.WithTypes(template.Type()),
+			packmanager.WithVersion(template.Version()),
+			packmanager.WithSource(template.Source()),
+		}
+
+		packs, err := packmanager.G(ctx).Catalog(ctx, append(qopts, packmanager.WithRemote(false))...)
+		if err == nil && len(packs) == 0 {
+			packs, err = packmanager.G(ctx).Catalog(ctx, append(qopts, packmanager.WithRemote(true))...)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(packs) == 0 {
+			return nil, fmt.Errorf("could not find template %s", unikraft.TypeNameVersion(template))
+		} else if len(packs) > 1 {
+			return nil, fmt.Errorf("found %d packages for template %s", len(packs), unikraft.TypeNameVersion(template))
+		}
+
+		if err := packs[0].Pull(ctx, pack.WithPullWorkdir(workdir)); err != nil {
+			return nil, fmt.Errorf("could not pull template %s: %w", unikraft.TypeNameVersion(template), err)
+		}
+	}
+
+	templateProject, err := app.NewProjectFromOptions(ctx,
+		app.WithProjectWorkdir(template.Path()),
+		app.WithProjectDefaultKraftfiles(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %s: %w", unikraft.TypeNameVersion(template), err)
+	}
+
+	return project.MergeTemplate(ctx, templateProject)
+}
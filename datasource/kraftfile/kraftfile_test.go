@@ -0,0 +1,83 @@
+package kraftfile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"kraftkit.sh/unikraft/app"
+)
+
+func TestConfig_parse_Template(t *testing.T) {
+	ctx, cleanup, err := unikraft.KraftCommandContext(context.Background(), packersdk.TestUi(t), unikraft.KraftOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	path := t.TempDir()
+	writeFile(t, filepath.Join(path, "Kraftfile"), `spec: v0.6
+
+name: hello
+
+template:
+  name: helloworld
+  version: stable
+
+cmd: ["/hello", "--verbose"]
+`)
+
+	// The template is placed where it is pulled to, such that it is found
+	// without the network.
+	project, err := app.NewProjectFromOptions(ctx,
+		app.WithProjectWorkdir(path),
+		app.WithProjectDefaultKraftfiles(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(project.Template().Path(), "Kraftfile"), `spec: v0.6
+
+name: helloworld
+
+unikraft:
+  version: stable
+
+targets:
+  - name: helloworld-qemu-x86_64
+    architecture: x86_64
+    platform: qemu
+
+cmd: ["/helloworld"]
+`)
+
+	output, err := (&Config{Path: path}).parse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(output.Targets) != 1 || output.Targets[0].Name != "helloworld-qemu-x86_64" {
+		t.Errorf("expected the targets of the template, got %+v", output.Targets)
+	}
+	if output.Name != "hello" {
+		t.Errorf("expected the name of the project, got %s", output.Name)
+	}
+	if len(output.Command) != 2 || output.Command[0] != "/hello" {
+		t.Errorf("expected the command of the project to override the template, got %v", output.Command)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
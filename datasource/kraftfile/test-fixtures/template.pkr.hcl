@@ -0,0 +1,21 @@
+data "unikraft-kraftfile" "nginx" {
+  // Path to the project
+  path = "test-fixtures/app"
+}
+
+source "null" "example" {
+  communicator = "none"
+}
+
+build {
+  sources = [
+    "source.null.example"
+  ]
+
+  provisioner "shell-local" {
+    inline = [
+      for target in data.unikraft-kraftfile.nginx.targets :
+      "echo target: ${target.name} ${target.platform}/${target.architecture}"
+    ]
+  }
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	unikraftBuilder "packer-plugin-unikraft/builder/unikraft"
+	unikraftCatalog "packer-plugin-unikraft/datasource/catalog"
+	unikraftKraftfile "packer-plugin-unikraft/datasource/kraftfile"
 	unikraftPP "packer-plugin-unikraft/post-processor/unikraft"
 	unikraftVersion "packer-plugin-unikraft/version"
 
@@ -14,6 +16,8 @@ func main() {
 	pps := plugin.NewSet()
 	pps.RegisterBuilder("builder", new(unikraftBuilder.Builder))
 	pps.RegisterPostProcessor("post-processor", new(unikraftPP.PostProcessor))
+	pps.RegisterDatasource("catalog", new(unikraftCatalog.Datasource))
+	pps.RegisterDatasource("kraftfile", new(unikraftKraftfile.Datasource))
 	pps.SetVersion(unikraftVersion.PluginVersion)
 	err := pps.Run()
 	if err != nil {
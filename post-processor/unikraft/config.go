@@ -3,7 +3,12 @@
 package unikraftpprocessor
 
 import (
+	"crypto/ecdsa"
 	"fmt"
+	"os"
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+	"path/filepath"
+	"strings"
 
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -17,24 +22,91 @@ const BuilderId = "packer.post-processor.unikraft"
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
-	// The path to the unformatted files.
-	FileSource string `mapstructure:"source" required:"true"`
+	// The path to the unformatted files.  Defaults to the build path of the
+	// builder artifact.
+	FileSource string `mapstructure:"source"`
 	// The path to the formatted files.
 	FileDestination string `mapstructure:"destination" required:"true"`
-	// The architecture of the unikernel. This is required.
-	Architecture string `mapstructure:"architecture" required:"true"`
-	// The platform of the unikernel. This is required.
-	Platform string `mapstructure:"platform" required:"true"`
+	// The architecture of the unikernel.  Defaults to the architecture of the
+	// kernel in the builder artifact.
+	Architecture string `mapstructure:"architecture"`
+	// The platform of the unikernel.  Defaults to the platform of the kernel in
+	// the builder artifact.
+	Platform string `mapstructure:"platform"`
 	// The specific target to package.
 	Target string `mapstructure:"target"`
 	// Whether to push the package to a registry.
 	Push bool `mapstructure:"push"`
 	// The rootfs to use.
 	Rootfs string `mapstructure:"rootfs"`
+	// The format of the rootfs: `cpio` to archive it into an initramfs, or
+	// `erofs` or `ext4` for a filesystem image which is packaged as is.
+	// Defaults to the format of the rootfs built by the builder, or `cpio`.
+	RootfsFormat string `mapstructure:"rootfs_format"`
+	// The format of the package, e.g. `oci`.  Defaults to `oci`.
+	Format string `mapstructure:"format"`
+	// Path to save the package to on disk, e.g. as an OCI image layout
+	// directory.  If the path ends in `.tar`, a tarball of the package is
+	// written instead.
+	Output string `mapstructure:"output"`
+	// Path to an OCI image layout directory shared between builds, in which
+	// the package is added to a multi-platform image index named after the
+	// destination.  Packages of the same platform are replaced.  Cannot be
+	// combined with push, as the index is only complete once every build is
+	// done.
+	IndexLayout string `mapstructure:"index_layout"`
+	// Path to a PEM encoded ECDSA private key, e.g. generated by `cosign
+	// generate-key-pair`, to sign the package with, together with the
+	// multi-platform index with index_layout.  Requires output or
+	// index_layout.
+	SigningKey string `mapstructure:"signing_key"`
+	// Password to decrypt the signing key with.
+	SigningKeyPassword string `mapstructure:"signing_key_password"`
+	// Whether to attach a signed provenance attestation to the package.
+	// Requires signing_key.
+	Attest bool `mapstructure:"attest"`
+	// Whether to attach the SBOM written by the builder to the package.
+	// Requires output or index_layout.
+	AttachSbom bool `mapstructure:"attach_sbom"`
+	// Labels to annotate the package with.
+	Labels map[string]string `mapstructure:"labels"`
+	// Arguments to pass to the unikernel.
+	Args []string `mapstructure:"args"`
+	// Environment variables to set in the package.  An empty value is taken
+	// from the environment of the host.
+	Env map[string]string `mapstructure:"env"`
+	// Path to the kernel to package.  Defaults to the kernel in the builder
+	// artifact.
+	Kernel string `mapstructure:"kernel"`
+	// The runtime to package the kernel with.
+	Runtime string `mapstructure:"runtime"`
+	// What to do when a package with the same name already exists: `abort`,
+	// `overwrite` or `merge`.
+	Strategy string `mapstructure:"strategy"`
+	// Do not include the KConfig of the kernel in the package.
+	NoKConfig bool `mapstructure:"no_kconfig"`
+	// Package the debuggable kernel image instead of the stripped one.
+	Dbg bool `mapstructure:"dbg"`
+	// Path to the Kraftfile, relative to the source.
+	Kraftfile string `mapstructure:"kraftfile"`
+	// The packager to use, e.g. `cli-kernel` to package the kernel on its own
+	// rather than the project in source.  Determined from the source by
+	// default.
+	Packager string `mapstructure:"packager"`
+	// Credentials of the registries to push the package to.
+	RegistryAuth []unikraft.RegistryAuth `mapstructure:"registry_auth"`
 	// Log level to use.
 	LogLevel string `mapstructure:"log_level"`
+	// Do not access the network, as for the builder.  Defaults to the
+	// offline setting of the builder artifact.
+	Offline bool `mapstructure:"offline"`
+	// Path to a directory holding an `index.yaml` manifest index to resolve
+	// packages from.  Defaults to the manifest mirror of the builder
+	// artifact.
+	ManifestMirror string `mapstructure:"manifest_mirror"`
 
-	ctx interpolate.Context
+	ctx        interpolate.Context
+	signingKey *ecdsa.PrivateKey
 }
 
 func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
@@ -56,17 +128,256 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 
 	// Accumulate any errors
 	var errs *packer.MultiError
-	if c.FileSource == "" {
-		errs = packer.MultiErrorAppend(errs, fmt.Errorf("file source must be specified"))
-	}
-
 	if c.FileDestination == "" {
 		errs = packer.MultiErrorAppend(errs, fmt.Errorf("file destination must be specified"))
 	}
 
+	if c.Format == "" {
+		c.Format = unikraft.DefaultPackageFormat
+	}
+
+	if c.Output != "" {
+		if c.Output, err = filepath.Abs(c.Output); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve output: %s", err))
+		}
+	}
+
+	if c.IndexLayout != "" {
+		if c.IndexLayout, err = filepath.Abs(c.IndexLayout); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve index_layout: %s", err))
+		}
+
+		if c.Output != "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("output and index_layout are mutually exclusive"))
+		}
+
+		if c.Format != unikraft.DefaultPackageFormat {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("index_layout is only supported with the %s format", unikraft.DefaultPackageFormat))
+		}
+
+		// Every build only holds its own platforms, so the index is pushed
+		// once all of them have been merged.
+		if c.Push {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("push and index_layout are mutually exclusive, push the layout once all builds are done"))
+		}
+	}
+
+	if c.SigningKeyPassword != "" {
+		packer.LogSecretFilter.Set(c.SigningKeyPassword)
+	}
+
+	if c.SigningKey != "" {
+		if c.signingKey, err = loadSigningKey(c.SigningKey, c.SigningKeyPassword); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not load signing_key: %s", err))
+		}
+
+		if c.Output == "" && c.IndexLayout == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("signing requires output or index_layout"))
+		}
+
+		if c.Format != unikraft.DefaultPackageFormat {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("signing is only supported with the %s format", unikraft.DefaultPackageFormat))
+		}
+	} else if c.Attest {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("attest requires signing_key"))
+	}
+
+	if c.AttachSbom {
+		if c.Output == "" && c.IndexLayout == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("attach_sbom requires output or index_layout"))
+		}
+
+		if c.Format != unikraft.DefaultPackageFormat {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("attach_sbom is only supported with the %s format", unikraft.DefaultPackageFormat))
+		}
+	}
+
+	if c.ManifestMirror != "" {
+		if c.ManifestMirror, err = filepath.Abs(c.ManifestMirror); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve manifest_mirror: %s", err))
+		} else if _, err := os.Stat(filepath.Join(c.ManifestMirror, "index.yaml")); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("manifest_mirror %s holds no index.yaml: %s", c.ManifestMirror, err))
+		}
+	}
+
+	if c.Offline && c.Push {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("push and offline are mutually exclusive"))
+	}
+
+	if c.Kernel != "" {
+		if c.Kernel, err = filepath.Abs(c.Kernel); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("could not resolve kernel: %s", err))
+		}
+	}
+
+	for k := range c.Labels {
+		if k == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("label names must not be empty"))
+		}
+	}
+
+	for k := range c.Env {
+		if k == "" || strings.ContainsRune(k, '=') {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid environment variable name %q", k))
+		}
+	}
+
+	for i := range c.RegistryAuth {
+		errs = packer.MultiErrorAppend(errs, c.RegistryAuth[i].Prepare()...)
+	}
+
+	switch c.Packager {
+	case "", unikraft.PackagerKraftfileUnikraft, unikraft.PackagerKraftfileRuntime, unikraft.PackagerCliKernel, unikraft.PackagerDockerfile:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid packager %q", c.Packager))
+	}
+
+	if c.Packager == unikraft.PackagerCliKernel && c.Target != "" {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("target is not supported with the %s packager, use architecture and platform", c.Packager))
+	}
+
+	if c.RootfsFormat != "" {
+		if _, ok := unikraft.RootfsCompressions[c.RootfsFormat]; !ok {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid rootfs_format %q, expected %s, %s or %s",
+				c.RootfsFormat, unikraft.RootfsFormatCpio, unikraft.RootfsFormatErofs, unikraft.RootfsFormatExt4))
+		}
+	}
+
+	switch c.Strategy {
+	case "", "abort", "overwrite", "merge":
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("invalid strategy %q, expected abort, overwrite or merge", c.Strategy))
+	}
+
 	if errs != nil && len(errs.Errors) > 0 {
 		return nil, errs
 	}
 
 	return nil, nil
 }
+
+// resolve defaults the fields which are not set from the kernels described by
+// the builder artifact, and checks that the fields which are set are
+// consistent with these.  It returns the kernel to package, if it was built
+// by the builder.
+func (c *Config) resolve(buildPath string, entries []unikraft.ArtifactEntry) (*unikraft.ArtifactEntry, error) {
+	cliKernel := c.Packager == unikraft.PackagerCliKernel
+
+	if c.FileSource == "" {
+		c.FileSource = buildPath
+	}
+
+	// A kernel is packaged on its own, without a project.
+	if c.FileSource == "" && !cliKernel {
+		return nil, fmt.Errorf("source must be specified, as the artifact does not hold a build path")
+	}
+
+	// Packaging something other than what was built, or an artifact of an
+	// older builder: nothing to default from.
+	if len(entries) == 0 || buildPath == "" || filepath.Clean(c.FileSource) != filepath.Clean(buildPath) {
+		if cliKernel && (c.Kernel == "" || c.Architecture == "" || c.Platform == "") {
+			return nil, fmt.Errorf("kernel, architecture and platform must be specified when not packaging the kernel built by the builder")
+		}
+
+		if c.Target == "" && (c.Architecture == "" || c.Platform == "") {
+			return nil, fmt.Errorf("architecture and platform, or target, must be specified when not packaging the kernel built by the builder")
+		}
+
+		return nil, nil
+	}
+
+	var matches []unikraft.ArtifactEntry
+	for _, entry := range entries {
+		if c.Target != "" {
+			if entry.Target == c.Target {
+				matches = append(matches, entry)
+			}
+			continue
+		}
+
+		if c.Architecture != "" && entry.Architecture != c.Architecture {
+			continue
+		}
+
+		if c.Platform != "" && entry.Platform != c.Platform {
+			continue
+		}
+
+		matches = append(matches, entry)
+	}
+
+	built := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		built = append(built, fmt.Sprintf("%s (%s/%s)", entry.Target, entry.Platform, entry.Architecture))
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no kernel built by the builder matches target %q, architecture %q and platform %q, built: %s",
+			c.Target, c.Architecture, c.Platform, strings.Join(built, ", "))
+	case 1:
+	default:
+		return nil, fmt.Errorf("multiple kernels built by the builder match, set target or architecture and platform to select one of: %s",
+			strings.Join(built, ", "))
+	}
+
+	match := matches[0]
+
+	// The kernel is packaged by its architecture and platform, rather than
+	// by its target in the Kraftfile.
+	if c.Target == "" || cliKernel {
+		c.Architecture = match.Architecture
+		c.Platform = match.Platform
+	}
+
+	if c.Rootfs == "" {
+		c.Rootfs = match.Initramfs
+
+		if c.RootfsFormat == "" {
+			c.RootfsFormat = match.RootfsFormat
+		}
+	}
+
+	return &match, nil
+}
+
+// defaultKraft defaults the offline mode and the manifest mirror to those the
+// builder used.
+func (c *Config) defaultKraft(offline bool, mirror string) error {
+	if offline && c.Push {
+		return fmt.Errorf("the artifact was built offline, packages cannot be pushed")
+	}
+
+	c.Offline = c.Offline || offline
+	if c.ManifestMirror == "" {
+		c.ManifestMirror = mirror
+	}
+
+	return nil
+}
+
+// defaultImage defaults the arguments and environment of the package to the
+// arguments and environment of the image the rootfs was flattened from.
+// Variables given in env take precedence over those of the image.
+func (c *Config) defaultImage(args, env []string) {
+	if len(c.Args) == 0 {
+		c.Args = args
+	}
+
+	if len(env) == 0 {
+		return
+	}
+
+	merged := make(map[string]string, len(env)+len(c.Env))
+	for _, kv := range env {
+		// An empty value would be taken from the environment of the host.
+		if k, v, _ := strings.Cut(kv, "="); k != "" && v != "" {
+			merged[k] = v
+		}
+	}
+	for k, v := range c.Env {
+		merged[k] = v
+	}
+
+	c.Env = merged
+}
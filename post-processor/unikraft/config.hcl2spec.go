@@ -3,6 +3,8 @@
 package unikraftpprocessor
 
 import (
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -10,22 +12,43 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
-	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
-	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
-	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
-	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
-	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
-	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
-	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	FileSource          *string           `mapstructure:"source" required:"true" cty:"source" hcl:"source"`
-	FileDestination     *string           `mapstructure:"destination" required:"true" cty:"destination" hcl:"destination"`
-	Architecture        *string           `mapstructure:"architecture" required:"true" cty:"architecture" hcl:"architecture"`
-	Platform            *string           `mapstructure:"platform" required:"true" cty:"platform" hcl:"platform"`
-	Target              *string           `mapstructure:"target" cty:"target" hcl:"target"`
-	Push                *bool             `mapstructure:"push" cty:"push" hcl:"push"`
-	Rootfs              *string           `mapstructure:"rootfs" cty:"rootfs" hcl:"rootfs"`
-	LogLevel            *string           `mapstructure:"log_level" cty:"log_level" hcl:"log_level"`
+	PackerBuildName     *string                     `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string                     `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string                     `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool                       `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool                       `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string                     `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string           `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string                    `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	FileSource          *string                     `mapstructure:"source" cty:"source" hcl:"source"`
+	FileDestination     *string                     `mapstructure:"destination" required:"true" cty:"destination" hcl:"destination"`
+	Architecture        *string                     `mapstructure:"architecture" cty:"architecture" hcl:"architecture"`
+	Platform            *string                     `mapstructure:"platform" cty:"platform" hcl:"platform"`
+	Target              *string                     `mapstructure:"target" cty:"target" hcl:"target"`
+	Push                *bool                       `mapstructure:"push" cty:"push" hcl:"push"`
+	Rootfs              *string                     `mapstructure:"rootfs" cty:"rootfs" hcl:"rootfs"`
+	RootfsFormat        *string                     `mapstructure:"rootfs_format" cty:"rootfs_format" hcl:"rootfs_format"`
+	Format              *string                     `mapstructure:"format" cty:"format" hcl:"format"`
+	Output              *string                     `mapstructure:"output" cty:"output" hcl:"output"`
+	IndexLayout         *string                     `mapstructure:"index_layout" cty:"index_layout" hcl:"index_layout"`
+	SigningKey          *string                     `mapstructure:"signing_key" cty:"signing_key" hcl:"signing_key"`
+	SigningKeyPassword  *string                     `mapstructure:"signing_key_password" cty:"signing_key_password" hcl:"signing_key_password"`
+	Attest              *bool                       `mapstructure:"attest" cty:"attest" hcl:"attest"`
+	AttachSbom          *bool                       `mapstructure:"attach_sbom" cty:"attach_sbom" hcl:"attach_sbom"`
+	Labels              map[string]string           `mapstructure:"labels" cty:"labels" hcl:"labels"`
+	Args                []string                    `mapstructure:"args" cty:"args" hcl:"args"`
+	Env                 map[string]string           `mapstructure:"env" cty:"env" hcl:"env"`
+	Kernel              *string                     `mapstructure:"kernel" cty:"kernel" hcl:"kernel"`
+	Runtime             *string                     `mapstructure:"runtime" cty:"runtime" hcl:"runtime"`
+	Strategy            *string                     `mapstructure:"strategy" cty:"strategy" hcl:"strategy"`
+	NoKConfig           *bool                       `mapstructure:"no_kconfig" cty:"no_kconfig" hcl:"no_kconfig"`
+	Dbg                 *bool                       `mapstructure:"dbg" cty:"dbg" hcl:"dbg"`
+	Kraftfile           *string                     `mapstructure:"kraftfile" cty:"kraftfile" hcl:"kraftfile"`
+	Packager            *string                     `mapstructure:"packager" cty:"packager" hcl:"packager"`
+	RegistryAuth        []unikraft.FlatRegistryAuth `mapstructure:"registry_auth" cty:"registry_auth" hcl:"registry_auth"`
+	LogLevel            *string                     `mapstructure:"log_level" cty:"log_level" hcl:"log_level"`
+	Offline             *bool                       `mapstructure:"offline" cty:"offline" hcl:"offline"`
+	ManifestMirror      *string                     `mapstructure:"manifest_mirror" cty:"manifest_mirror" hcl:"manifest_mirror"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -55,7 +78,28 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"target":                     &hcldec.AttrSpec{Name: "target", Type: cty.String, Required: false},
 		"push":                       &hcldec.AttrSpec{Name: "push", Type: cty.Bool, Required: false},
 		"rootfs":                     &hcldec.AttrSpec{Name: "rootfs", Type: cty.String, Required: false},
+		"rootfs_format":              &hcldec.AttrSpec{Name: "rootfs_format", Type: cty.String, Required: false},
+		"format":                     &hcldec.AttrSpec{Name: "format", Type: cty.String, Required: false},
+		"output":                     &hcldec.AttrSpec{Name: "output", Type: cty.String, Required: false},
+		"index_layout":               &hcldec.AttrSpec{Name: "index_layout", Type: cty.String, Required: false},
+		"signing_key":                &hcldec.AttrSpec{Name: "signing_key", Type: cty.String, Required: false},
+		"signing_key_password":       &hcldec.AttrSpec{Name: "signing_key_password", Type: cty.String, Required: false},
+		"attest":                     &hcldec.AttrSpec{Name: "attest", Type: cty.Bool, Required: false},
+		"attach_sbom":                &hcldec.AttrSpec{Name: "attach_sbom", Type: cty.Bool, Required: false},
+		"labels":                     &hcldec.AttrSpec{Name: "labels", Type: cty.Map(cty.String), Required: false},
+		"args":                       &hcldec.AttrSpec{Name: "args", Type: cty.List(cty.String), Required: false},
+		"env":                        &hcldec.AttrSpec{Name: "env", Type: cty.Map(cty.String), Required: false},
+		"kernel":                     &hcldec.AttrSpec{Name: "kernel", Type: cty.String, Required: false},
+		"runtime":                    &hcldec.AttrSpec{Name: "runtime", Type: cty.String, Required: false},
+		"strategy":                   &hcldec.AttrSpec{Name: "strategy", Type: cty.String, Required: false},
+		"no_kconfig":                 &hcldec.AttrSpec{Name: "no_kconfig", Type: cty.Bool, Required: false},
+		"dbg":                        &hcldec.AttrSpec{Name: "dbg", Type: cty.Bool, Required: false},
+		"kraftfile":                  &hcldec.AttrSpec{Name: "kraftfile", Type: cty.String, Required: false},
+		"packager":                   &hcldec.AttrSpec{Name: "packager", Type: cty.String, Required: false},
+		"registry_auth":              &hcldec.BlockListSpec{TypeName: "registry_auth", Nested: hcldec.ObjectSpec((*unikraft.FlatRegistryAuth)(nil).HCL2Spec())},
 		"log_level":                  &hcldec.AttrSpec{Name: "log_level", Type: cty.String, Required: false},
+		"offline":                    &hcldec.AttrSpec{Name: "offline", Type: cty.Bool, Required: false},
+		"manifest_mirror":            &hcldec.AttrSpec{Name: "manifest_mirror", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -0,0 +1,288 @@
+package unikraftpprocessor
+
+import (
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfig_Prepare(t *testing.T) {
+	var c Config
+	if _, err := c.Prepare(map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "destination") {
+		t.Fatalf("expected destination to be required, got %v", err)
+	}
+
+	c = Config{}
+	if _, err := c.Prepare(map[string]interface{}{"destination": "unikraft.org/helloworld:latest"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.Format != unikraft.DefaultPackageFormat {
+		t.Errorf("expected format to default to %s, got %s", unikraft.DefaultPackageFormat, c.Format)
+	}
+
+	for _, raw := range []map[string]interface{}{
+		{"strategy": "prompt"},
+		{"env": map[string]string{"A=B": "C"}},
+		{"labels": map[string]string{"": "C"}},
+		{"packager": "unknown"},
+		{"packager": "cli-kernel", "target": "app-qemu-x86_64"},
+		{"index_layout": "/tmp/layout", "output": "/tmp/out"},
+		{"index_layout": "/tmp/layout", "format": "tarball"},
+		{"index_layout": "/tmp/layout", "push": true},
+		{"attest": true, "output": "/tmp/out"},
+		{"signing_key": "/nonexistent/cosign.key", "output": "/tmp/out"},
+		{"attach_sbom": true},
+		{"rootfs_format": "squashfs"},
+		{"offline": true, "push": true},
+		{"manifest_mirror": "/nonexistent/mirror"},
+	} {
+		raw["destination"] = "unikraft.org/helloworld:latest"
+
+		c = Config{}
+		if _, err := c.Prepare(raw); err == nil {
+			t.Errorf("expected an error for %v", raw)
+		}
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	m := map[string]string{"B": "", "A": "1"}
+
+	if got, want := keyValues(m), []string{"A=1", "B="}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got, want := envList(m), []string{"A=1", "B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestConfig_resolve(t *testing.T) {
+	entries := []unikraft.ArtifactEntry{
+		{
+			Kernel:       "/app/.unikraft/build/app_qemu-x86_64",
+			Initramfs:    "/app/.unikraft/build/initramfs-x86_64.cpio",
+			RootfsFormat: "cpio",
+			Architecture: "x86_64",
+			Platform:     "qemu",
+			Target:       "app-qemu-x86_64",
+		},
+		{
+			Kernel:       "/app/.unikraft/build/app_fc-x86_64",
+			Architecture: "x86_64",
+			Platform:     "fc",
+			Target:       "app-fc-x86_64",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		config    Config
+		buildPath string
+		entries   []unikraft.ArtifactEntry
+		err       string
+		want      Config
+		kernel    string
+	}{
+		{
+			name:      "single kernel",
+			buildPath: "/app",
+			entries:   entries[:1],
+			want: Config{
+				FileSource:   "/app",
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				Rootfs:       "/app/.unikraft/build/initramfs-x86_64.cpio",
+				RootfsFormat: "cpio",
+			},
+			kernel: "/app/.unikraft/build/app_qemu-x86_64",
+		},
+		{
+			name:      "erofs rootfs",
+			config:    Config{Platform: "fc"},
+			buildPath: "/app",
+			entries: []unikraft.ArtifactEntry{
+				entries[0],
+				{
+					Kernel:       "/app/.unikraft/build/app_fc-x86_64",
+					Initramfs:    "/app/.unikraft/build/rootfs-x86_64.erofs",
+					RootfsFormat: "erofs",
+					Architecture: "x86_64",
+					Platform:     "fc",
+				},
+			},
+			want: Config{
+				FileSource:   "/app",
+				Architecture: "x86_64",
+				Platform:     "fc",
+				Rootfs:       "/app/.unikraft/build/rootfs-x86_64.erofs",
+				RootfsFormat: "erofs",
+			},
+			kernel: "/app/.unikraft/build/app_fc-x86_64",
+		},
+		{
+			name:      "ambiguous",
+			buildPath: "/app",
+			entries:   entries,
+			err:       "multiple kernels",
+		},
+		{
+			name:      "select by platform",
+			config:    Config{Platform: "fc", Rootfs: "/rootfs"},
+			buildPath: "/app",
+			entries:   entries,
+			want: Config{
+				FileSource:   "/app",
+				Architecture: "x86_64",
+				Platform:     "fc",
+				Rootfs:       "/rootfs",
+			},
+			kernel: "/app/.unikraft/build/app_fc-x86_64",
+		},
+		{
+			name:      "select by target",
+			config:    Config{Target: "app-qemu-x86_64"},
+			buildPath: "/app/",
+			entries:   entries,
+			want: Config{
+				FileSource:   "/app/",
+				Target:       "app-qemu-x86_64",
+				Rootfs:       "/app/.unikraft/build/initramfs-x86_64.cpio",
+				RootfsFormat: "cpio",
+			},
+			kernel: "/app/.unikraft/build/app_qemu-x86_64",
+		},
+		{
+			name:      "inconsistent",
+			config:    Config{Architecture: "arm64"},
+			buildPath: "/app",
+			entries:   entries,
+			err:       "no kernel built by the builder matches",
+		},
+		{
+			name:      "other source",
+			config:    Config{FileSource: "/other", Architecture: "arm64", Platform: "qemu"},
+			buildPath: "/app",
+			entries:   entries,
+			want:      Config{FileSource: "/other", Architecture: "arm64", Platform: "qemu"},
+		},
+		{
+			name:      "other source without architecture",
+			config:    Config{FileSource: "/other"},
+			buildPath: "/app",
+			entries:   entries,
+			err:       "architecture and platform, or target, must be specified",
+		},
+		{
+			name: "no build path",
+			err:  "source must be specified",
+		},
+		{
+			name:      "cli-kernel from artifact",
+			config:    Config{Packager: "cli-kernel", Platform: "qemu"},
+			buildPath: "/app",
+			entries:   entries,
+			want: Config{
+				FileSource:   "/app",
+				Architecture: "x86_64",
+				Platform:     "qemu",
+				Rootfs:       "/app/.unikraft/build/initramfs-x86_64.cpio",
+				RootfsFormat: "cpio",
+				Packager:     "cli-kernel",
+			},
+			kernel: "/app/.unikraft/build/app_qemu-x86_64",
+		},
+		{
+			name:   "cli-kernel without artifact",
+			config: Config{Packager: "cli-kernel", Kernel: "/kernel", Architecture: "arm64", Platform: "fc"},
+			want:   Config{Packager: "cli-kernel", Kernel: "/kernel", Architecture: "arm64", Platform: "fc"},
+		},
+		{
+			name:   "cli-kernel without kernel",
+			config: Config{Packager: "cli-kernel", Architecture: "arm64", Platform: "fc"},
+			err:    "kernel, architecture and platform must be specified",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.config
+			entry, err := c.resolve(tt.buildPath, tt.entries)
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if c.FileSource != tt.want.FileSource ||
+				c.Architecture != tt.want.Architecture ||
+				c.Platform != tt.want.Platform ||
+				c.Target != tt.want.Target ||
+				c.Rootfs != tt.want.Rootfs ||
+				c.RootfsFormat != tt.want.RootfsFormat {
+				t.Errorf("expected %+v, got %+v", tt.want, c)
+			}
+
+			var kernel string
+			if entry != nil {
+				kernel = entry.Kernel
+			}
+			if kernel != tt.kernel {
+				t.Errorf("expected kernel %q, got %q", tt.kernel, kernel)
+			}
+		})
+	}
+}
+
+func TestConfig_defaultImage(t *testing.T) {
+	imageArgs := []string{"/usr/bin/nginx", "-g", "daemon off;"}
+	imageEnv := []string{"PATH=/usr/bin", "NGINX_VERSION=1.25", "EMPTY="}
+
+	c := Config{Env: map[string]string{"NGINX_VERSION": "1.27", "HOME": ""}}
+	c.defaultImage(imageArgs, imageEnv)
+
+	if !reflect.DeepEqual(c.Args, imageArgs) {
+		t.Errorf("expected args %v, got %v", imageArgs, c.Args)
+	}
+	if got, want := envList(c.Env), []string{"HOME", "NGINX_VERSION=1.27", "PATH=/usr/bin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected env %v, got %v", want, got)
+	}
+
+	c = Config{Args: []string{"-c", "/etc/nginx.conf"}}
+	c.defaultImage(imageArgs, nil)
+
+	if want := []string{"-c", "/etc/nginx.conf"}; !reflect.DeepEqual(c.Args, want) {
+		t.Errorf("expected args %v to be kept, got %v", want, c.Args)
+	}
+	if c.Env != nil {
+		t.Errorf("expected no env, got %v", c.Env)
+	}
+}
+
+func TestConfig_defaultKraft(t *testing.T) {
+	c := Config{}
+	if err := c.defaultKraft(true, "/tmp/mirror"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Offline || c.ManifestMirror != "/tmp/mirror" {
+		t.Errorf("expected the settings of the builder, got offline %t and mirror %q", c.Offline, c.ManifestMirror)
+	}
+
+	c = Config{Offline: true, ManifestMirror: "/tmp/other"}
+	if err := c.defaultKraft(false, "/tmp/mirror"); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Offline || c.ManifestMirror != "/tmp/other" {
+		t.Errorf("expected the settings of the post-processor, got offline %t and mirror %q", c.Offline, c.ManifestMirror)
+	}
+
+	c = Config{Push: true}
+	if err := c.defaultKraft(true, ""); err == nil {
+		t.Error("expected an error pushing an artifact built offline")
+	}
+}
@@ -0,0 +1,353 @@
+package unikraftpprocessor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// mergeIntoIndex merges the images of the OCI image layout at src into the
+// layout at dst, where they are listed in an image index under the reference
+// ref.  Images which are already listed for the same platform are replaced,
+// such that builds for different platforms, which may run concurrently in
+// separate processes, together assemble a single multi-platform index.
+//
+// The given platform is used for the images which do not declare one.
+func mergeIntoIndex(src, dst, ref string, platform ocispec.Platform) error {
+	if err := os.MkdirAll(filepath.Join(dst, ocispec.ImageBlobsDir, digest.SHA256.String()), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lockLayout(dst)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	srcIndex, err := readIndex(filepath.Join(src, ocispec.ImageIndexFile))
+	if err != nil {
+		return err
+	}
+
+	var packages, attachments []ocispec.Descriptor
+	for _, desc := range srcIndex.Manifests {
+		if isAttachment(desc) {
+			attachments = append(attachments, desc)
+		} else {
+			packages = append(packages, desc)
+		}
+	}
+
+	images, err := layoutImages(src, packages)
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("no images found in %s", src)
+	}
+
+	if err := copyBlobs(src, dst); err != nil {
+		return err
+	}
+
+	if err := writeLayout(dst); err != nil {
+		return err
+	}
+
+	dstIndexFile := filepath.Join(dst, ocispec.ImageIndexFile)
+	dstIndex, err := readIndex(dstIndexFile)
+	if errors.Is(err, os.ErrNotExist) {
+		dstIndex = newIndex()
+	} else if err != nil {
+		return err
+	}
+
+	// Find the index which was assembled for the reference so far.
+	refIndex := newIndex()
+	var manifests []ocispec.Descriptor
+	for _, desc := range dstIndex.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] != ref {
+			manifests = append(manifests, desc)
+			continue
+		}
+
+		if desc.MediaType != ocispec.MediaTypeImageIndex {
+			continue
+		}
+
+		refIndex, err = readIndex(blobPath(dst, desc.Digest))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, image := range images {
+		if image.Platform == nil {
+			if platform.OS == "" || platform.Architecture == "" {
+				return fmt.Errorf("the platform of image %s is unknown, specify architecture and platform", image.Digest)
+			}
+
+			p := platform
+			image.Platform = &p
+		}
+
+		kept := refIndex.Manifests[:0]
+		for _, desc := range refIndex.Manifests {
+			if !samePlatform(desc.Platform, image.Platform) {
+				kept = append(kept, desc)
+			}
+		}
+
+		refIndex.Manifests = append(kept, image)
+	}
+
+	desc, err := writeBlob(dst, ocispec.MediaTypeImageIndex, refIndex)
+	if err != nil {
+		return err
+	}
+
+	desc.Annotations = map[string]string{
+		ocispec.AnnotationRefName: ref,
+	}
+	dstIndex.Manifests = append(manifests, desc)
+
+	// Signatures, attestations and SBOMs are tagged after the digest of the
+	// image, and are thus kept apart from the index.
+	for _, att := range attachments {
+		dstIndex.Manifests = setTag(dstIndex.Manifests, att, att.Annotations[ocispec.AnnotationRefName], att.Annotations[kindAnnotation])
+	}
+
+	return writeJSON(dstIndexFile, dstIndex)
+}
+
+// lockLayout takes an exclusive lock on the OCI image layout, which builds
+// running concurrently in separate processes share, and returns the function
+// releasing it.  The lock file is kept next to the layout, such that the
+// layout only ever holds the image, and is removed on release.
+func lockLayout(layout string) (func(), error) {
+	path := filepath.Clean(layout) + ".lock"
+
+	for {
+		// The lock file is held open to tell whether it is still in place once
+		// locked: the previous holder removes it on release, after which other
+		// processes lock a new one.
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not lock %s: %w", layout, err)
+		}
+
+		lock := flock.New(path)
+		if err := lock.Lock(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %w", layout, err)
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			lock.Unlock()
+			f.Close()
+			return nil, err
+		}
+
+		if current, err := os.Stat(path); err == nil && os.SameFile(locked, current) {
+			return func() {
+				os.Remove(path)
+				lock.Unlock()
+				f.Close()
+			}, nil
+		}
+
+		lock.Unlock()
+		f.Close()
+	}
+}
+
+// layoutImages returns the descriptors of the image manifests reachable from
+// the given descriptors, descending into nested indexes.
+func layoutImages(layout string, descs []ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	var images []ocispec.Descriptor
+
+	for _, desc := range descs {
+		if isAttachment(desc) {
+			continue
+		}
+
+		switch desc.MediaType {
+		case ocispec.MediaTypeImageManifest:
+			// Only keep the reference of the shared index.
+			desc.Annotations = nil
+			images = append(images, desc)
+
+		case ocispec.MediaTypeImageIndex:
+			index, err := readIndex(blobPath(layout, desc.Digest))
+			if err != nil {
+				return nil, err
+			}
+
+			nested, err := layoutImages(layout, index.Manifests)
+			if err != nil {
+				return nil, err
+			}
+
+			images = append(images, nested...)
+		}
+	}
+
+	return images, nil
+}
+
+// samePlatform returns whether both platforms describe the same host.
+func samePlatform(a, b *ocispec.Platform) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant
+}
+
+func newIndex() ocispec.Index {
+	return ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageIndex,
+	}
+}
+
+func blobPath(layout string, d digest.Digest) string {
+	return filepath.Join(layout, ocispec.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+}
+
+func readIndex(path string) (ocispec.Index, error) {
+	var index ocispec.Index
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return index, err
+	}
+
+	if err := json.Unmarshal(b, &index); err != nil {
+		return index, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	return index, nil
+}
+
+// writeLayout writes the `oci-layout` file, if it does not exist yet.
+func writeLayout(layout string) error {
+	path := filepath.Join(layout, ocispec.ImageLayoutFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return writeJSON(path, ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+}
+
+// writeBlob stores v as a JSON blob in the layout and returns its descriptor.
+func writeBlob(layout, mediaType string, v interface{}) (ocispec.Descriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(b),
+		Size:      int64(len(b)),
+	}
+
+	if err := writeFile(blobPath(layout, desc.Digest), b); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+func writeJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, b)
+}
+
+// writeFile replaces the file at path atomically, such that readers which do
+// not hold the lock never observe a partially written file.
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyBlobs copies the blobs of the layout at src which are missing from dst.
+func copyBlobs(src, dst string) error {
+	blobs := filepath.Join(src, ocispec.ImageBlobsDir)
+
+	return filepath.Walk(blobs, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(blobs, path)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(dst, ocispec.ImageBlobsDir, rel)
+		if _, err := os.Stat(dest); err == nil {
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+
+		if _, err := io.Copy(tmp, in); err != nil {
+			tmp.Close()
+			return err
+		}
+
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		return os.Rename(tmp.Name(), dest)
+	})
+}
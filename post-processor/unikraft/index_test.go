@@ -0,0 +1,232 @@
+package unikraftpprocessor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testLayout writes an OCI image layout with a single image whose manifest
+// holds the given content, optionally wrapped in a nested index.
+func testLayout(t *testing.T, content string, nested bool) (string, ocispec.Descriptor) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	manifest := ocispec.Manifest{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   ocispec.MediaTypeImageManifest,
+		Annotations: map[string]string{"content": content},
+	}
+	desc, err := writeBlob(dir, ocispec.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc.Annotations = map[string]string{ocispec.AnnotationRefName: "local"}
+
+	index := newIndex()
+	index.Manifests = []ocispec.Descriptor{desc}
+
+	if nested {
+		idesc, err := writeBlob(dir, ocispec.MediaTypeImageIndex, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index.Manifests = []ocispec.Descriptor{idesc}
+	}
+
+	if err := writeLayout(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(filepath.Join(dir, ocispec.ImageIndexFile), index); err != nil {
+		t.Fatal(err)
+	}
+
+	desc.Annotations = nil
+	return dir, desc
+}
+
+// refManifests returns the manifests listed for ref in the layout.
+func refManifests(t *testing.T, layout, ref string) []ocispec.Descriptor {
+	t.Helper()
+
+	index, err := readIndex(filepath.Join(layout, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] != ref {
+			continue
+		}
+
+		refIndex, err := readIndex(blobPath(layout, desc.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return refIndex.Manifests
+	}
+
+	return nil
+}
+
+func TestMergeIntoIndex(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "layout")
+	ref := "unikraft.org/nginx:1.2"
+
+	qemu := ocispec.Platform{Architecture: "x86_64", OS: "qemu"}
+	fc := ocispec.Platform{Architecture: "x86_64", OS: "fc"}
+
+	src1, desc1 := testLayout(t, "qemu", false)
+	if err := mergeIntoIndex(src1, dst, ref, qemu); err != nil {
+		t.Fatal(err)
+	}
+
+	src2, desc2 := testLayout(t, "fc", true)
+	if err := mergeIntoIndex(src2, dst, ref, fc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another reference is kept apart.
+	src3, _ := testLayout(t, "other", false)
+	if err := mergeIntoIndex(src3, dst, "unikraft.org/other:latest", qemu); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests := refManifests(t, dst, ref)
+	if len(manifests) != 2 {
+		t.Fatalf("expected 2 manifests, got %d", len(manifests))
+	}
+	if manifests[0].Digest != desc1.Digest || !samePlatform(manifests[0].Platform, &qemu) {
+		t.Errorf("unexpected manifest %+v", manifests[0])
+	}
+	if manifests[1].Digest != desc2.Digest || !samePlatform(manifests[1].Platform, &fc) {
+		t.Errorf("unexpected manifest %+v", manifests[1])
+	}
+	if manifests[0].Annotations != nil {
+		t.Errorf("expected the annotations of the package to be dropped, got %v", manifests[0].Annotations)
+	}
+
+	// Rebuilding a platform replaces its manifest.
+	src4, desc4 := testLayout(t, "qemu again", false)
+	if err := mergeIntoIndex(src4, dst, ref, qemu); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests = refManifests(t, dst, ref)
+	if len(manifests) != 2 || manifests[0].Digest != desc2.Digest || manifests[1].Digest != desc4.Digest {
+		t.Errorf("expected the qemu manifest to be replaced, got %+v", manifests)
+	}
+
+	// Every referenced blob is available in the layout.
+	for _, desc := range append(manifests, desc1) {
+		b, err := os.ReadFile(blobPath(dst, desc.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest.FromBytes(b) != desc.Digest {
+			t.Errorf("blob %s does not match its digest", desc.Digest)
+		}
+	}
+
+	var layout ocispec.ImageLayout
+	b, err := os.ReadFile(filepath.Join(dst, ocispec.ImageLayoutFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &layout); err != nil || layout.Version != ocispec.ImageLayoutVersion {
+		t.Errorf("unexpected oci-layout %s", b)
+	}
+}
+
+func TestMergeIntoIndex_Concurrent(t *testing.T) {
+	dst := t.TempDir()
+	ref := "unikraft.org/nginx:1.2"
+
+	archs := []string{"x86_64", "arm64", "arm", "riscv64"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(archs))
+	for i, arch := range archs {
+		src, _ := testLayout(t, arch, false)
+
+		wg.Add(1)
+		go func(i int, src, arch string) {
+			defer wg.Done()
+			errs[i] = mergeIntoIndex(src, dst, ref, ocispec.Platform{Architecture: arch, OS: "qemu"})
+		}(i, src, arch)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if manifests := refManifests(t, dst, ref); len(manifests) != len(archs) {
+		t.Errorf("expected %d manifests, got %d", len(archs), len(manifests))
+	}
+
+	// The lock file is neither left within the layout nor next to it.
+	for _, path := range []string{filepath.Join(dst, ".lock"), dst + ".lock"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected no lock file %s, got %v", path, err)
+		}
+	}
+}
+
+func TestLockLayout(t *testing.T) {
+	layout := filepath.Join(t.TempDir(), "oci")
+
+	unlock, err := lockLayout(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := lockLayout(layout)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("expected the layout to stay locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case unlock := <-locked:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the layout to be locked once released")
+	}
+
+	if _, err := os.Stat(layout + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestMergeIntoIndex_UnknownPlatform(t *testing.T) {
+	src, _ := testLayout(t, "qemu", false)
+
+	if err := mergeIntoIndex(src, t.TempDir(), "unikraft.org/nginx:1.2", ocispec.Platform{}); err == nil {
+		t.Error("expected an error for an image without platform")
+	}
+}
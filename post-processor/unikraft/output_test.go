@@ -0,0 +1,102 @@
+package unikraftpprocessor
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"oci-layout":         `{"imageLayoutVersion":"1.0.0"}`,
+		"index.json":         `{"schemaVersion":2}`,
+		"blobs/sha256/abcd":  "kernel",
+		"blobs/sha256/empty": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "out", "package.tar")
+	if err := archiveDir(dir, dest); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, hdr.Name)
+
+		if want, ok := files[hdr.Name]; ok {
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, tr); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != want {
+				t.Errorf("expected %s to contain %q, got %q", hdr.Name, want, buf.String())
+			}
+		}
+	}
+
+	want := []string{
+		"blobs/",
+		"blobs/sha256/",
+		"blobs/sha256/abcd",
+		"blobs/sha256/empty",
+		"index.json",
+		"oci-layout",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected entries %v, got %v", want, names)
+	}
+
+	// Archiving the same contents again results in the same tarball.
+	again := filepath.Join(t.TempDir(), "package.tar")
+	if err := archiveDir(dir, again); err != nil {
+		t.Fatal(err)
+	}
+
+	a, _ := os.ReadFile(dest)
+	b, _ := os.ReadFile(again)
+	if !bytes.Equal(a, b) {
+		t.Error("expected archives to be identical")
+	}
+}
+
+func TestIsTarball(t *testing.T) {
+	for output, want := range map[string]bool{
+		"":                   false,
+		"/tmp/layout":        false,
+		"/tmp/package.tar":   true,
+		"/tmp/package.tar/x": false,
+	} {
+		if got := isTarball(output); got != want {
+			t.Errorf("isTarball(%q) = %t, expected %t", output, got, want)
+		}
+	}
+}
@@ -3,13 +3,14 @@ package unikraftpprocessor
 import (
 	"context"
 	"fmt"
+	"os"
 	unikraft "packer-plugin-unikraft/builder/unikraft"
+	"sort"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
-	"github.com/hashicorp/packer-plugin-sdk/template/config"
-	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/mitchellh/mapstructure"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type PostProcessor struct {
@@ -19,18 +20,8 @@ type PostProcessor struct {
 func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
 
 func (p *PostProcessor) Configure(raws ...interface{}) error {
-	err := config.Decode(&p.config, &config.DecodeOpts{
-		PluginType:         "packer.post-processor.unikraft",
-		Interpolate:        true,
-		InterpolateContext: &p.config.ctx,
-		InterpolateFilter: &interpolate.RenderFilter{
-			Exclude: []string{},
-		},
-	}, raws...)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := p.config.Prepare(raws...)
+	return err
 }
 
 func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source packersdk.Artifact) (packersdk.Artifact, bool, bool, error) {
@@ -41,41 +32,288 @@ func (p *PostProcessor) PostProcess(ctx context.Context, ui packersdk.Ui, source
 		return nil, false, false, fmt.Errorf("unknown artifact %s", source.BuilderId())
 	}
 
-	var binaries []string
-	if err := mapstructure.Decode(source.State("binaries"), &binaries); err != nil {
-		err := fmt.Errorf("failed to decode binaries")
+	entries, err := artifactEntries(source)
+	if err != nil {
+		err := fmt.Errorf("failed to decode kernels: %s", err)
 		ui.Error(err.Error())
 		return source, false, false, err
 	}
 
+	var buildPath string
+	if err := mapstructure.Decode(source.State("build_path"), &buildPath); err != nil {
+		err := fmt.Errorf("failed to decode build path: %s", err)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	var sbom string
+	if err := mapstructure.Decode(source.State("sbom"), &sbom); err != nil {
+		err := fmt.Errorf("failed to decode sbom: %s", err)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	if p.config.AttachSbom && sbom == "" {
+		err := fmt.Errorf("the artifact holds no sbom to attach, set sbom in the builder")
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	// Work on a copy, such that the defaults of one artifact do not leak into
+	// the next.
+	config := p.config
+
+	entry, err := config.resolve(buildPath, entries)
+	if err != nil {
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	// The rootfs of the kernel built by the builder may come from an image.
+	if entry != nil {
+		var imageArgs, imageEnv []string
+		if err := mapstructure.Decode(source.State("image_args"), &imageArgs); err != nil {
+			err := fmt.Errorf("failed to decode image arguments: %s", err)
+			ui.Error(err.Error())
+			return source, false, false, err
+		}
+		if err := mapstructure.Decode(source.State("image_env"), &imageEnv); err != nil {
+			err := fmt.Errorf("failed to decode image environment: %s", err)
+			ui.Error(err.Error())
+			return source, false, false, err
+		}
+
+		config.defaultImage(imageArgs, imageEnv)
+	}
+
+	kernel := config.Kernel
+	if kernel == "" && entry != nil {
+		kernel = entry.Kernel
+		if config.Dbg && entry.KernelDbg != "" {
+			kernel = entry.KernelDbg
+		}
+	}
+
+	var offline bool
+	if err := mapstructure.Decode(source.State("offline"), &offline); err != nil {
+		err := fmt.Errorf("failed to decode offline: %s", err)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	var mirror string
+	if err := mapstructure.Decode(source.State("manifest_mirror"), &mirror); err != nil {
+		err := fmt.Errorf("failed to decode manifest mirror: %s", err)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	if err := config.defaultKraft(offline, mirror); err != nil {
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	kraftCtx, cleanup, err := unikraft.KraftCommandContext(ctx, ui, unikraft.KraftOptions{
+		LogLevel:       config.LogLevel,
+		RegistryAuth:   config.RegistryAuth,
+		Offline:        config.Offline,
+		ManifestMirror: config.ManifestMirror,
+	})
+	if err != nil {
+		err := fmt.Errorf("error encountered initialising kraft: %s", err)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+	defer cleanup()
+
 	driver := &unikraft.KraftDriver{
-		Ctx:            &p.config.ctx,
+		Ctx:            &config.ctx,
 		Ui:             ui,
-		CommandContext: unikraft.KraftCommandContext(ui, p.config.LogLevel),
+		CommandContext: kraftCtx,
+		Offline:        config.Offline,
+	}
+
+	if config.Packager == unikraft.PackagerCliKernel && kernel == "" {
+		err := fmt.Errorf("no kernel to package using %s", config.Packager)
+		ui.Error(err.Error())
+		return source, false, false, err
+	}
+
+	// The platform of the package within a multi-platform index.
+	platform := ocispec.Platform{
+		Architecture: config.Architecture,
+		OS:           config.Platform,
+	}
+	if entry != nil {
+		platform.Architecture = entry.Architecture
+		platform.OS = entry.Platform
 	}
 
-	if p.config.Target != "" {
-		p.config.Architecture = ""
-		p.config.Platform = ""
+	if config.Target != "" {
+		config.Architecture = ""
+		config.Platform = ""
 	}
 
-	err := driver.Pkg(
-		p.config.Architecture,
-		p.config.Platform,
-		p.config.Target,
-		p.config.FileDestination,
-		p.config.FileSource,
-		p.config.Rootfs,
-		p.config.Push,
-	)
+	// Tarballs and multi-platform indexes are created from a package written
+	// to a temporary directory.
+	output := config.Output
+	if isTarball(config.Output) || config.IndexLayout != "" {
+		if output, err = os.MkdirTemp("", "packer-unikraft-"); err != nil {
+			err := fmt.Errorf("error encountered creating temporary directory: %s", err)
+			ui.Error(err.Error())
+			return source, false, false, err
+		}
+		defer os.RemoveAll(output)
+	}
+
+	err = driver.Pkg(ctx, unikraft.PackageOptions{
+		Architecture: config.Architecture,
+		Platform:     config.Platform,
+		Target:       config.Target,
+		Name:         config.FileDestination,
+		Workdir:      config.FileSource,
+		Kernel:       kernel,
+		Rootfs:       config.Rootfs,
+		RootfsFormat: config.RootfsFormat,
+		Format:       config.Format,
+		Output:       output,
+		Labels:       keyValues(config.Labels),
+		Args:         config.Args,
+		Env:          envList(config.Env),
+		Runtime:      config.Runtime,
+		Strategy:     config.Strategy,
+		NoKConfig:    config.NoKConfig,
+		Dbg:          config.Dbg,
+		Kraftfile:    config.Kraftfile,
+		Packager:     config.Packager,
+		Push:         config.Push,
+	})
 	if err != nil {
 		return nil, false, false, fmt.Errorf("packaging error: %s", err)
 	}
 
+	if output != "" {
+		if _, err := os.Stat(output); err != nil {
+			err := fmt.Errorf("no package was written to %s: %s", output, err)
+			ui.Error(err.Error())
+			return nil, false, false, err
+		}
+	}
+
+	if config.AttachSbom {
+		ui.Say(fmt.Sprintf("Attaching sbom %s", sbom))
+
+		if err := attachSbom(output, sbom); err != nil {
+			err := fmt.Errorf("error encountered attaching sbom: %s", err)
+			ui.Error(err.Error())
+			return nil, false, false, err
+		}
+	}
+
+	if config.signingKey != nil {
+		var prov *provenance
+		if config.Attest {
+			prov = &provenance{
+				Source:    config.FileSource,
+				Kraftfile: config.Kraftfile,
+			}
+			if entry != nil {
+				prov.Entry = *entry
+			} else {
+				prov.Entry.Architecture = platform.Architecture
+				prov.Entry.Platform = platform.OS
+			}
+		}
+
+		ui.Say(fmt.Sprintf("Signing package %s", config.FileDestination))
+
+		if err := signLayout(output, config.FileDestination, config.signingKey, prov); err != nil {
+			err := fmt.Errorf("error encountered signing package: %s", err)
+			ui.Error(err.Error())
+			return nil, false, false, err
+		}
+	}
+
+	if config.IndexLayout != "" {
+		ui.Say(fmt.Sprintf("Adding package to the index of %s in %s", config.FileDestination, config.IndexLayout))
+
+		if err := mergeIntoIndex(output, config.IndexLayout, config.FileDestination, platform); err != nil {
+			err := fmt.Errorf("error encountered adding package to index: %s", err)
+			ui.Error(err.Error())
+			return nil, false, false, err
+		}
+
+		if config.signingKey != nil {
+			ui.Say(fmt.Sprintf("Signing the index of %s", config.FileDestination))
+
+			if err := signIndex(config.IndexLayout, config.FileDestination, config.signingKey); err != nil {
+				err := fmt.Errorf("error encountered signing index: %s", err)
+				ui.Error(err.Error())
+				return nil, false, false, err
+			}
+		}
+	} else if output != config.Output {
+		ui.Say(fmt.Sprintf("Archiving package to %s", config.Output))
+
+		if err := archiveDir(output, config.Output); err != nil {
+			err := fmt.Errorf("error encountered archiving package: %s", err)
+			ui.Error(err.Error())
+			return nil, false, false, err
+		}
+	}
+
 	artifact := &unikraft.Artifact{
 		StateData: map[string]interface{}{
-			"oci": p.config.FileDestination,
+			"oci":    config.FileDestination,
+			"format": config.Format,
+			"output": config.Output,
+			"index":  config.IndexLayout,
 		},
 	}
 	return artifact, true, true, nil
 }
+
+// artifactEntries returns the kernels described by the builder artifact.
+func artifactEntries(source packersdk.Artifact) ([]unikraft.ArtifactEntry, error) {
+	switch entries := source.State("entries").(type) {
+	case nil:
+		return nil, nil
+	case []unikraft.ArtifactEntry:
+		return entries, nil
+	default:
+		var decoded []unikraft.ArtifactEntry
+		if err := mapstructure.Decode(entries, &decoded); err != nil {
+			return nil, err
+		}
+
+		return decoded, nil
+	}
+}
+
+// keyValues returns the map as a sorted list of `KEY=value` entries.
+func keyValues(m map[string]string) []string {
+	list := make([]string, 0, len(m))
+	for k, v := range m {
+		list = append(list, k+"="+v)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// envList returns the environment variables as a sorted list of `KEY=value`
+// entries.  Variables with an empty value are listed as `KEY`, such that
+// their value is taken from the environment of the host.
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for k, v := range env {
+		if v == "" {
+			list = append(list, k)
+		} else {
+			list = append(list, k+"="+v)
+		}
+	}
+	sort.Strings(list)
+
+	return list
+}
@@ -0,0 +1,123 @@
+package unikraftpprocessor
+
+import (
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	statementType       = "https://in-toto.io/Statement/v1"
+	predicateProvenance = "https://slsa.dev/provenance/v1"
+	buildType           = "https://github.com/unikraft/packer-plugin-unikraft/buildtypes/kraft-pkg/v1"
+)
+
+// provenance describes how a package was built.
+type provenance struct {
+	// Path to the project the package was built from.
+	Source string
+	// Path to the Kraftfile, relative to Source.
+	Kraftfile string
+	// The kernel which was packaged.
+	Entry unikraft.ArtifactEntry
+}
+
+// statement is an in-toto statement with a SLSA provenance predicate.
+type statement struct {
+	Type          string                  `json:"_type"`
+	Subject       []statementSubject      `json:"subject"`
+	PredicateType string                  `json:"predicateType"`
+	Predicate     slsaProvenancePredicate `json:"predicate"`
+}
+
+type statementSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenancePredicate struct {
+	BuildDefinition slsaBuildDefinition `json:"buildDefinition"`
+	RunDetails      slsaRunDetails      `json:"runDetails"`
+}
+
+type slsaBuildDefinition struct {
+	BuildType            string                   `json:"buildType"`
+	ExternalParameters   map[string]string        `json:"externalParameters"`
+	InternalParameters   map[string]string        `json:"internalParameters,omitempty"`
+	ResolvedDependencies []slsaResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+type slsaResourceDescriptor struct {
+	Name        string            `json:"name"`
+	URI         string            `json:"uri,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type slsaRunDetails struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+}
+
+// statement returns the provenance of the image with the given digest, which
+// is packaged under the reference ref.
+func (p *provenance) statement(ref string, d digest.Digest) statement {
+	params := map[string]string{
+		"source": p.Source,
+	}
+	for k, v := range map[string]string{
+		"kraftfile":    p.Kraftfile,
+		"target":       p.Entry.Target,
+		"architecture": p.Entry.Architecture,
+		"platform":     p.Entry.Platform,
+	} {
+		if v != "" {
+			params[k] = v
+		}
+	}
+
+	var internal map[string]string
+	if p.Entry.Version != "" {
+		internal = map[string]string{"unikraftVersion": p.Entry.Version}
+	}
+
+	var deps []slsaResourceDescriptor
+	if p.Entry.Sha256 != "" {
+		deps = append(deps, slsaResourceDescriptor{
+			Name:   "kernel",
+			Digest: map[string]string{"sha256": p.Entry.Sha256},
+		})
+	}
+	for _, comp := range p.Entry.Components {
+		dep := slsaResourceDescriptor{
+			Name: comp.Type + "/" + comp.Name,
+			URI:  comp.Source,
+		}
+		if comp.Version != "" {
+			dep.Annotations = map[string]string{"version": comp.Version}
+		}
+
+		deps = append(deps, dep)
+	}
+
+	s := statement{
+		Type: statementType,
+		Subject: []statementSubject{{
+			Name:   repository(ref),
+			Digest: map[string]string{d.Algorithm().String(): d.Encoded()},
+		}},
+		PredicateType: predicateProvenance,
+		Predicate: slsaProvenancePredicate{
+			BuildDefinition: slsaBuildDefinition{
+				BuildType:            buildType,
+				ExternalParameters:   params,
+				InternalParameters:   internal,
+				ResolvedDependencies: deps,
+			},
+		},
+	}
+	s.Predicate.RunDetails.Builder.ID = BuilderId
+
+	return s
+}
@@ -0,0 +1,47 @@
+package unikraftpprocessor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const mediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+
+// attachSbom attaches the CycloneDX SBOM at path to every image of the OCI
+// image layout, as `cosign attach sbom` does, i.e. in an image tagged
+// `sha256-<digest>.sbom`.
+func attachSbom(layout, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	indexFile := filepath.Join(layout, ocispec.ImageIndexFile)
+	index, err := readIndex(indexFile)
+	if err != nil {
+		return err
+	}
+
+	images, err := layoutImages(layout, index.Manifests)
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("no images found in %s", layout)
+	}
+
+	desc, err := writeAttachment(layout, mediaTypeCycloneDX, b, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		index.Manifests = setTag(index.Manifests, desc, tagFor(image.Digest, "sbom"), kindSBOM)
+	}
+
+	return writeJSON(indexFile, index)
+}
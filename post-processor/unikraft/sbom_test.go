@@ -0,0 +1,48 @@
+package unikraftpprocessor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestAttachSbom(t *testing.T) {
+	layout, image := testLayout(t, "qemu", false)
+
+	sbom := filepath.Join(t.TempDir(), "sbom.cdx.json")
+	if err := os.WriteFile(sbom, []byte(`{"bomFormat":"CycloneDX"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := attachSbom(layout, sbom); err != nil {
+		t.Fatal(err)
+	}
+
+	layer, b := signatureLayer(t, layout, tagFor(image.Digest, "sbom"))
+	if layer.MediaType != mediaTypeCycloneDX {
+		t.Errorf("unexpected media type %s", layer.MediaType)
+	}
+	if string(b) != `{"bomFormat":"CycloneDX"}` {
+		t.Errorf("unexpected sbom %s", b)
+	}
+
+	// Only the package is signed, not its sbom.
+	key, _ := testKey(t, "PRIVATE KEY", "")
+	if err := signLayout(layout, "unikraft.org/nginx:1.25", key, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := readIndex(filepath.Join(layout, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 3 {
+		t.Errorf("expected the package, its sbom and signature, got %d manifests", len(index.Manifests))
+	}
+
+	if err := attachSbom(layout, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing sbom")
+	}
+}
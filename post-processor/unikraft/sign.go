@@ -0,0 +1,346 @@
+package unikraftpprocessor
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/encrypted"
+)
+
+const (
+	// Media types and annotations of cosign signature and attestation images.
+	mediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	mediaTypeDSSE          = "application/vnd.dsse.envelope.v1+json"
+	annotationSignature    = "dev.cosignproject.cosign/signature"
+	annotationPredicate    = "predicateType"
+
+	// kindAnnotation tells apart the images, signatures and attestations in
+	// an OCI image layout written by cosign.  SBOMs are told apart likewise.
+	kindAnnotation  = "kind"
+	kindSignatures  = "dev.cosignproject.cosign/sigs"
+	kindAttestation = "dev.cosignproject.cosign/atts"
+	kindSBOM        = "dev.cosignproject.cosign/sboms"
+
+	// annotationSignedIndex holds the reference of the multi-platform index
+	// a signature was made for.
+	annotationSignedIndex = "org.unikraft.packer.signed-index"
+
+	payloadTypeInToto = "application/vnd.in-toto+json"
+)
+
+// loadSigningKey reads an ECDSA private key from the PEM file at path.  Keys
+// generated by `cosign generate-key-pair` are decrypted with the password.
+func loadSigningKey(path, password string) (*ecdsa.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM encoded key", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		var der []byte
+		if der, err = encrypted.Decrypt(block.Bytes, []byte(password)); err != nil {
+			return nil, fmt.Errorf("could not decrypt %s: %w", path, err)
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ECDSA key", path)
+	}
+
+	return ecKey, nil
+}
+
+// simpleSigning is the payload signed by cosign for an image.
+type simpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// dsseEnvelope is a signed DSSE envelope.
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// signLayout signs the images of the OCI image layout, which are packaged
+// under the reference ref.  The signatures are stored as cosign does, i.e.
+// in images tagged `sha256-<digest>.sig` next to the signed ones.  If
+// provenance is given, an attestation tagged `sha256-<digest>.att` is added
+// for every image as well.
+func signLayout(layout, ref string, key *ecdsa.PrivateKey, provenance *provenance) error {
+	indexFile := filepath.Join(layout, ocispec.ImageIndexFile)
+	index, err := readIndex(indexFile)
+	if err != nil {
+		return err
+	}
+
+	images, err := layoutImages(layout, index.Manifests)
+	if err != nil {
+		return err
+	}
+
+	if len(images) == 0 {
+		return fmt.Errorf("no images found in %s", layout)
+	}
+
+	for _, image := range images {
+		desc, err := writeSignature(layout, ref, image.Digest, key)
+		if err != nil {
+			return err
+		}
+
+		index.Manifests = setTag(index.Manifests, desc, tagFor(image.Digest, "sig"), kindSignatures)
+
+		if provenance == nil {
+			continue
+		}
+
+		statement := provenance.statement(ref, image.Digest)
+		b, err := json.Marshal(statement)
+		if err != nil {
+			return err
+		}
+
+		sig, err := sign(key, pae(payloadTypeInToto, b))
+		if err != nil {
+			return err
+		}
+
+		envelope, err := json.Marshal(dsseEnvelope{
+			PayloadType: payloadTypeInToto,
+			Payload:     base64.StdEncoding.EncodeToString(b),
+			Signatures:  []dsseSignature{{Sig: sig}},
+		})
+		if err != nil {
+			return err
+		}
+
+		desc, err = writeAttachment(layout, mediaTypeDSSE, envelope, map[string]string{
+			annotationPredicate: statement.PredicateType,
+		})
+		if err != nil {
+			return err
+		}
+
+		index.Manifests = setTag(index.Manifests, desc, tagFor(image.Digest, "att"), kindAttestation)
+	}
+
+	return writeJSON(indexFile, index)
+}
+
+// signIndex signs the multi-platform image index listed under the reference
+// ref in the OCI image layout shared between builds, as assembled by
+// mergeIntoIndex, such that the index can be verified as well as the images
+// it lists.  The signature of the index replaced by the last merge is
+// removed.
+func signIndex(layout, ref string, key *ecdsa.PrivateKey) error {
+	unlock, err := lockLayout(layout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	indexFile := filepath.Join(layout, ocispec.ImageIndexFile)
+	index, err := readIndex(indexFile)
+	if err != nil {
+		return err
+	}
+
+	var refIndex *ocispec.Descriptor
+	for i, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] == ref && desc.MediaType == ocispec.MediaTypeImageIndex {
+			refIndex = &index.Manifests[i]
+		}
+	}
+
+	if refIndex == nil {
+		return fmt.Errorf("no index of %s found in %s", ref, layout)
+	}
+
+	desc, err := writeSignature(layout, ref, refIndex.Digest, key)
+	if err != nil {
+		return err
+	}
+
+	tag := tagFor(refIndex.Digest, "sig")
+
+	// Signatures of the index are annotated with the reference, such that
+	// the one of a previous merge can be told apart from those of images.
+	kept := index.Manifests[:0]
+	for _, d := range index.Manifests {
+		if d.Annotations[annotationSignedIndex] != ref {
+			kept = append(kept, d)
+		}
+	}
+
+	index.Manifests = setTag(kept, desc, tag, kindSignatures)
+	index.Manifests[len(index.Manifests)-1].Annotations[annotationSignedIndex] = ref
+
+	return writeJSON(indexFile, index)
+}
+
+// writeSignature stores a cosign signature of the image or index with the
+// given digest, packaged under the reference ref, and returns the descriptor
+// of the signature image.
+func writeSignature(layout, ref string, d digest.Digest, key *ecdsa.PrivateKey) (ocispec.Descriptor, error) {
+	payload := simpleSigning{}
+	payload.Critical.Identity.DockerReference = repository(ref)
+	payload.Critical.Image.DockerManifestDigest = d.String()
+	payload.Critical.Type = "cosign container image signature"
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	sig, err := sign(key, b)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return writeAttachment(layout, mediaTypeSimpleSigning, b, map[string]string{
+		annotationSignature: sig,
+	})
+}
+
+// sign returns the base64 encoded ECDSA signature of the SHA-256 digest of b.
+func sign(key *ecdsa.PrivateKey, b []byte) (string, error) {
+	sum := sha256.Sum256(b)
+
+	sig, err := key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("could not sign: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// pae returns the DSSE pre-authentication encoding of the payload.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// writeAttachment stores an image with a single layer holding b, as cosign
+// does for signatures, attestations and SBOMs, and returns its descriptor.
+func writeAttachment(layout, mediaType string, b []byte, annotations map[string]string) (ocispec.Descriptor, error) {
+	layer := ocispec.Descriptor{
+		MediaType:   mediaType,
+		Digest:      digest.FromBytes(b),
+		Size:        int64(len(b)),
+		Annotations: annotations,
+	}
+
+	if err := writeFile(blobPath(layout, layer.Digest), b); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	config, err := writeBlob(layout, ocispec.MediaTypeImageConfig, ocispec.Image{
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{layer.Digest},
+		},
+	})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return writeBlob(layout, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+}
+
+// setTag lists desc under tag in the descriptors of an index, replacing the
+// descriptor previously listed under the same tag.
+func setTag(descs []ocispec.Descriptor, desc ocispec.Descriptor, tag, kind string) []ocispec.Descriptor {
+	desc.Annotations = map[string]string{
+		ocispec.AnnotationRefName: tag,
+		kindAnnotation:            kind,
+	}
+
+	kept := descs[:0]
+	for _, d := range descs {
+		if d.Annotations[ocispec.AnnotationRefName] != tag {
+			kept = append(kept, d)
+		}
+	}
+
+	return append(kept, desc)
+}
+
+// isAttachment returns whether the descriptor lists a signature, attestation
+// or SBOM image rather than a package.
+func isAttachment(desc ocispec.Descriptor) bool {
+	switch desc.Annotations[kindAnnotation] {
+	case kindSignatures, kindAttestation, kindSBOM:
+		return true
+	}
+
+	return false
+}
+
+// tagFor returns the tag cosign uses for the signatures, attestations or SBOM
+// of the image with the given digest.
+func tagFor(d digest.Digest, suffix string) string {
+	return fmt.Sprintf("%s-%s.%s", d.Algorithm(), d.Encoded(), suffix)
+}
+
+// repository returns the reference without its tag or digest.
+func repository(ref string) string {
+	if i := strings.Index(ref, "@"); i >= 0 {
+		ref = ref[:i]
+	}
+
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+
+	return ref
+}
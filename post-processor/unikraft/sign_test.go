@@ -0,0 +1,320 @@
+package unikraftpprocessor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	unikraft "packer-plugin-unikraft/builder/unikraft"
+	"path/filepath"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/encrypted"
+)
+
+// testKey writes a new ECDSA key to a PEM file of the given type.
+func testKey(t *testing.T, pemType, password string) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var der []byte
+	switch pemType {
+	case "EC PRIVATE KEY":
+		der, err = x509.MarshalECPrivateKey(key)
+	default:
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if password != "" {
+		if der, err = encrypted.Encrypt(der, []byte(password)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return key, path
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	for _, pemType := range []string{"EC PRIVATE KEY", "PRIVATE KEY"} {
+		key, path := testKey(t, pemType, "")
+
+		loaded, err := loadSigningKey(path, "")
+		if err != nil {
+			t.Fatalf("%s: %s", pemType, err)
+		}
+		if !loaded.Equal(key) {
+			t.Errorf("%s: loaded a different key", pemType)
+		}
+	}
+
+	key, path := testKey(t, "ENCRYPTED SIGSTORE PRIVATE KEY", "secret")
+	if _, err := loadSigningKey(path, "wrong"); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+	loaded, err := loadSigningKey(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(key) {
+		t.Error("loaded a different encrypted key")
+	}
+}
+
+// signatureLayer returns the single layer of the image tagged tag.
+func signatureLayer(t *testing.T, layout, tag string) (ocispec.Descriptor, []byte) {
+	t.Helper()
+
+	index, err := readIndex(filepath.Join(layout, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] != tag {
+			continue
+		}
+
+		var manifest ocispec.Manifest
+		b, err := os.ReadFile(blobPath(layout, desc.Digest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Layers) != 1 {
+			t.Fatalf("expected a single layer in %s, got %d", tag, len(manifest.Layers))
+		}
+
+		layer := manifest.Layers[0]
+		if b, err = os.ReadFile(blobPath(layout, layer.Digest)); err != nil {
+			t.Fatal(err)
+		}
+
+		return layer, b
+	}
+
+	t.Fatalf("no image tagged %s", tag)
+	return ocispec.Descriptor{}, nil
+}
+
+func verify(t *testing.T, key *ecdsa.PrivateKey, b []byte, sig string) {
+	t.Helper()
+
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(b)
+	if !ecdsa.VerifyASN1(&key.PublicKey, sum[:], raw) {
+		t.Error("invalid signature")
+	}
+}
+
+func TestSignLayout(t *testing.T) {
+	key, _ := testKey(t, "PRIVATE KEY", "")
+	layout, image := testLayout(t, "qemu", true)
+	ref := "unikraft.org/nginx:1.25"
+
+	prov := &provenance{
+		Source: "/app",
+		Entry: unikraft.ArtifactEntry{
+			Architecture: "x86_64",
+			Platform:     "qemu",
+			Target:       "nginx-qemu-x86_64",
+			Version:      "0.16.1",
+			Sha256:       "abc",
+			Components: []unikraft.Component{
+				{Type: "lib", Name: "musl", Version: "stable", Source: "https://github.com/unikraft/lib-musl.git"},
+			},
+		},
+	}
+
+	// Signing again replaces the previous signatures.
+	for i := 0; i < 2; i++ {
+		if err := signLayout(layout, ref, key, prov); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index, err := readIndex(filepath.Join(layout, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 3 {
+		t.Errorf("expected the package, its signature and attestation, got %d manifests", len(index.Manifests))
+	}
+
+	layer, payload := signatureLayer(t, layout, tagFor(image.Digest, "sig"))
+	if layer.MediaType != mediaTypeSimpleSigning {
+		t.Errorf("unexpected media type %s", layer.MediaType)
+	}
+	verify(t, key, payload, layer.Annotations[annotationSignature])
+
+	var signed simpleSigning
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		t.Fatal(err)
+	}
+	if signed.Critical.Identity.DockerReference != "unikraft.org/nginx" {
+		t.Errorf("unexpected reference %s", signed.Critical.Identity.DockerReference)
+	}
+	if signed.Critical.Image.DockerManifestDigest != image.Digest.String() {
+		t.Errorf("unexpected digest %s", signed.Critical.Image.DockerManifestDigest)
+	}
+
+	layer, b := signatureLayer(t, layout, tagFor(image.Digest, "att"))
+	if layer.MediaType != mediaTypeDSSE || layer.Annotations[annotationPredicate] != predicateProvenance {
+		t.Errorf("unexpected attestation layer %+v", layer)
+	}
+
+	var envelope dsseEnvelope
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	payload, err = base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify(t, key, pae(envelope.PayloadType, payload), envelope.Signatures[0].Sig)
+
+	var s statement
+	if err := json.Unmarshal(payload, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Subject[0].Digest["sha256"] != image.Digest.Encoded() {
+		t.Errorf("unexpected subject %+v", s.Subject)
+	}
+	if s.Predicate.BuildDefinition.ExternalParameters["target"] != "nginx-qemu-x86_64" {
+		t.Errorf("unexpected parameters %v", s.Predicate.BuildDefinition.ExternalParameters)
+	}
+	if s.Predicate.BuildDefinition.InternalParameters["unikraftVersion"] != "0.16.1" {
+		t.Errorf("unexpected internal parameters %v", s.Predicate.BuildDefinition.InternalParameters)
+	}
+	if deps := s.Predicate.BuildDefinition.ResolvedDependencies; len(deps) != 2 || deps[1].Name != "lib/musl" || deps[1].Annotations["version"] != "stable" {
+		t.Errorf("unexpected dependencies %+v", deps)
+	}
+
+	// Signatures are carried over into a shared index.
+	dst := t.TempDir()
+	if err := mergeIntoIndex(layout, dst, ref, ocispec.Platform{Architecture: "x86_64", OS: "qemu"}); err != nil {
+		t.Fatal(err)
+	}
+	if manifests := refManifests(t, dst, ref); len(manifests) != 1 || manifests[0].Digest != image.Digest {
+		t.Errorf("expected only the package in the index, got %+v", manifests)
+	}
+	signatureLayer(t, dst, tagFor(image.Digest, "sig"))
+	signatureLayer(t, dst, tagFor(image.Digest, "att"))
+}
+
+// refIndex returns the descriptor of the index listed for ref in the layout.
+func refIndex(t *testing.T, layout, ref string) ocispec.Descriptor {
+	t.Helper()
+
+	index, err := readIndex(filepath.Join(layout, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range index.Manifests {
+		if desc.Annotations[ocispec.AnnotationRefName] == ref {
+			return desc
+		}
+	}
+
+	t.Fatalf("no index of %s found", ref)
+	return ocispec.Descriptor{}
+}
+
+func TestSignIndex(t *testing.T) {
+	key, _ := testKey(t, "PRIVATE KEY", "")
+	ref := "unikraft.org/nginx:1.25"
+	dst := t.TempDir()
+
+	if err := signIndex(dst, ref, key); err == nil {
+		t.Error("expected an error without index")
+	}
+
+	var previous ocispec.Descriptor
+	for _, plat := range []string{"qemu", "fc"} {
+		layout, _ := testLayout(t, plat, false)
+		if err := mergeIntoIndex(layout, dst, ref, ocispec.Platform{Architecture: "x86_64", OS: plat}); err != nil {
+			t.Fatal(err)
+		}
+		if err := signIndex(dst, ref, key); err != nil {
+			t.Fatal(err)
+		}
+
+		current := refIndex(t, dst, ref)
+		if current.Digest == previous.Digest {
+			t.Fatal("expected the merge to change the index")
+		}
+
+		layer, payload := signatureLayer(t, dst, tagFor(current.Digest, "sig"))
+		verify(t, key, payload, layer.Annotations[annotationSignature])
+
+		var signed simpleSigning
+		if err := json.Unmarshal(payload, &signed); err != nil {
+			t.Fatal(err)
+		}
+		if signed.Critical.Image.DockerManifestDigest != current.Digest.String() {
+			t.Errorf("unexpected digest %s", signed.Critical.Image.DockerManifestDigest)
+		}
+
+		previous = current
+	}
+
+	// Only the signature of the last index is kept.
+	index, err := readIndex(filepath.Join(dst, ocispec.ImageIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 {
+		t.Errorf("expected the index and its signature, got %+v", index.Manifests)
+	}
+	if manifests := refManifests(t, dst, ref); len(manifests) != 2 {
+		t.Errorf("expected the packages of both platforms, got %+v", manifests)
+	}
+
+	// Signing leaves no lock file within the signed layout.
+	entries, err := os.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != ocispec.ImageBlobsDir && entry.Name() != ocispec.ImageIndexFile && entry.Name() != ocispec.ImageLayoutFile {
+			t.Errorf("unexpected %s in the layout", entry.Name())
+		}
+	}
+}
+
+func TestRepository(t *testing.T) {
+	for ref, want := range map[string]string{
+		"unikraft.org/nginx:1.25":              "unikraft.org/nginx",
+		"localhost:5000/nginx":                 "localhost:5000/nginx",
+		"localhost:5000/nginx:1.25":            "localhost:5000/nginx",
+		"unikraft.org/nginx@sha256:abcdef0123": "unikraft.org/nginx",
+	} {
+		if got := repository(ref); got != want {
+			t.Errorf("repository(%s) = %s, want %s", ref, got, want)
+		}
+	}
+}